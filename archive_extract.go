@@ -0,0 +1,123 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// archive_extract.go
+
+package gox
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExtractOptions defines limits protecting against zip bombs when extracting an archive
+type ExtractOptions struct {
+	MaxMemberSize int64 // Maximum bytes written for a member, DefaultMaxMemberSize if 0
+	MaxMembers    int   // Maximum number of members, DefaultMaxMembers if 0
+	MaxTotalSize  int64 // Maximum bytes written for all members, unlimited if 0
+}
+
+// Unzip extracts a zip archive into dir
+func Unzip(zipFilename string, dir string) error {
+	return ExtractArchive(zipFilename, dir, ExtractOptions{})
+}
+
+// ExtractArchive extracts a zip, tar or tar.gz archive into dir, keeping permissions and modification times
+// Members escaping dir, such as ../../etc/passwd, fail the extraction and links are skipped
+func ExtractArchive(filename string, dir string, opts ExtractOptions) error {
+	var err error
+	if opts.MaxMemberSize <= 0 {
+		opts.MaxMemberSize = DefaultMaxMemberSize
+	}
+	if opts.MaxMembers <= 0 {
+		opts.MaxMembers = DefaultMaxMembers
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var count int
+	var total int64
+	var dirs []archiveMember
+	err = walkArchive(filename, func(member archiveMember, reader io.Reader) error {
+		if count++; count > opts.MaxMembers {
+			return &fs.PathError{Op: "extract", Path: filename, Err: ErrArchiveLimit}
+		}
+		if !member.isDir && !member.mode.IsRegular() {
+			return nil
+		}
+		target, err := extractPath(dir, member.name)
+		if err != nil {
+			return err
+		}
+		if member.isDir {
+			member.name = target
+			dirs = append(dirs, member)
+			return os.MkdirAll(target, member.mode.Perm()|0700)
+		}
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		limit := opts.MaxMemberSize
+		if opts.MaxTotalSize > 0 && opts.MaxTotalSize-total < limit {
+			limit = opts.MaxTotalSize - total
+		}
+		var n int64
+		if n, err = extractFile(target, member, reader, limit); err != nil {
+			return err
+		}
+		total += n
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// directory times are set last because extracting files into them updates their times
+	for _, d := range dirs {
+		if !d.modTime.IsZero() {
+			os.Chtimes(d.name, time.Now(), d.modTime)
+		}
+	}
+	return nil
+}
+
+// extractPath returns the path of a member under dir, failing on names escaping dir
+func extractPath(dir string, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(dir, target); err != nil || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal member path %q", name)
+	}
+	return target, nil
+}
+
+// extractFile writes at most limit bytes of a member to target
+func extractFile(target string, member archiveMember, reader io.Reader, limit int64) (int64, error) {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, member.mode.Perm())
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.CopyN(file, reader, limit+1)
+	if err == io.EOF {
+		err = nil
+	} else if err == nil {
+		err = &fs.PathError{Op: "extract", Path: member.name, Err: ErrArchiveLimit}
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(target)
+		return n, err
+	}
+	if !member.modTime.IsZero() {
+		err = os.Chtimes(target, time.Now(), member.modTime)
+	}
+	return n, err
+}
@@ -0,0 +1,102 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// archive_extract_test.go
+
+package gox
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnzip(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "logs"), 0755)
+	modTime := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
+	files := map[string]string{"logs/mongod.log": "log line\n", "mongod.conf": "net:\n  port: 27017\n"}
+	for name, data := range files {
+		filename := filepath.Join(src, name)
+		if err := os.WriteFile(filename, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(filename, modTime, modTime)
+	}
+	zipFilename := filepath.Join(t.TempDir(), "bundle.zip")
+	file, err := os.Create(zipFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ZipFilesTo(file, []string{src}, ZipOptions{BaseDir: src}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	dir := t.TempDir()
+	if err = Unzip(zipFilename, dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		filename := filepath.Join(dir, name)
+		b, err := os.ReadFile(filename)
+		if err != nil || string(b) != data {
+			t.Errorf("%s = %q %v, expected %q", name, b, err, data)
+			continue
+		}
+		info, _ := os.Stat(filename)
+		if info.Mode().Perm() != 0600 || !info.ModTime().Equal(modTime) {
+			t.Errorf("%s should keep mode and time, got %v %v", name, info.Mode(), info.ModTime())
+		}
+	}
+}
+
+func TestExtractArchiveTarGz(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	createTestTarGz(t, filename, map[string]string{"./logs/mongod.log": "log line\n", "/etc/mongod.conf": "net:\n"})
+	dir := t.TempDir()
+	if err := ExtractArchive(filename, dir, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"logs/mongod.log", "etc/mongod.conf"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestExtractArchiveUnsafe(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "slip.zip")
+	file, _ := os.Create(filename)
+	writer := zip.NewWriter(file)
+	w, _ := writer.Create("logs/../../evil.txt")
+	w.Write([]byte("evil"))
+	writer.Close()
+	file.Close()
+
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := Unzip(filename, dir); err == nil || !strings.Contains(err.Error(), "illegal member path") {
+		t.Errorf("expected illegal member path, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "evil.txt")); err == nil {
+		t.Errorf("member should not be extracted outside of dir")
+	}
+
+	filename = filepath.Join(t.TempDir(), "bomb.zip")
+	file, _ = os.Create(filename)
+	writer = zip.NewWriter(file)
+	for _, name := range []string{"a.log", "b.log"} {
+		w, _ = writer.Create(name)
+		w.Write([]byte(strings.Repeat("0", 4096)))
+	}
+	writer.Close()
+	file.Close()
+	tests := []ExtractOptions{{MaxMemberSize: 1024}, {MaxMembers: 1}, {MaxTotalSize: 6000}}
+	for _, opts := range tests {
+		if err := ExtractArchive(filename, t.TempDir(), opts); !errors.Is(err, ErrArchiveLimit) {
+			t.Errorf("expected limit error with %+v, got %v", opts, err)
+		}
+	}
+}
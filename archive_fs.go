@@ -0,0 +1,376 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// archive_fs.go
+
+package gox
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxMemberSize is the default limit of decompressed bytes read from an archive member
+	DefaultMaxMemberSize = int64(4 << 30)
+	// DefaultMaxMembers is the default limit of members in an archive
+	DefaultMaxMembers = 100000
+)
+
+// ErrArchiveLimit is returned when an archive exceeds its member size or count limit
+var ErrArchiveLimit = errors.New("archive limit exceeded")
+
+// ArchiveFSOptions defines limits protecting against zip bombs
+type ArchiveFSOptions struct {
+	MaxMemberSize int64 // Maximum decompressed bytes read from a member, DefaultMaxMemberSize if 0
+	MaxMembers    int   // Maximum number of members, DefaultMaxMembers if 0
+}
+
+// ArchiveFS exposes members of a zip, tar or tar.gz archive as an fs.FS without extracting them
+// Compressed members, such as mongod.log.2.gz, are decompressed when read
+type ArchiveFS struct {
+	filename string
+	format   string
+	opts     ArchiveFSOptions
+	zreader  *zip.ReadCloser
+	entries  map[string]*archiveEntry
+	members  int
+}
+
+// archiveEntry is a file or directory of an ArchiveFS, it is both fs.FileInfo and fs.DirEntry
+type archiveEntry struct {
+	fullPath string
+	size     int64
+	mode     fs.FileMode
+	modTime  time.Time
+	zfile    *zip.File
+	children []*archiveEntry
+}
+
+// NewArchiveFS indexes the members of a zip, tar or tar.gz archive
+func NewArchiveFS(filename string, opts ArchiveFSOptions) (*ArchiveFS, error) {
+	var err error
+	if opts.MaxMemberSize <= 0 {
+		opts.MaxMemberSize = DefaultMaxMemberSize
+	}
+	if opts.MaxMembers <= 0 {
+		opts.MaxMembers = DefaultMaxMembers
+	}
+	fsys := &ArchiveFS{filename: filename, opts: opts,
+		entries: map[string]*archiveEntry{".": {fullPath: ".", mode: fs.ModeDir | 0755}}}
+	if fsys.format, err = archiveFormat(filename); err != nil {
+		return nil, err
+	}
+
+	if fsys.format == "zip" {
+		if fsys.zreader, err = zip.OpenReader(filename); err != nil {
+			return nil, err
+		}
+		for _, f := range fsys.zreader.File {
+			entry := &archiveEntry{size: int64(f.UncompressedSize64), mode: f.Mode(), modTime: f.Modified, zfile: f}
+			if err = fsys.add(f.Name, entry); err != nil {
+				fsys.zreader.Close()
+				return nil, err
+			}
+		}
+	} else {
+		if err = fsys.indexTar(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range fsys.entries {
+		sort.Slice(entry.children, func(i, j int) bool {
+			return entry.children[i].fullPath < entry.children[j].fullPath
+		})
+	}
+	return fsys, nil
+}
+
+// add adds a member and its missing parent directories, skipping names that are not valid fs paths
+func (fsys *ArchiveFS) add(name string, entry *archiveEntry) error {
+	if fsys.members++; fsys.members > fsys.opts.MaxMembers {
+		return &fs.PathError{Op: "open", Path: fsys.filename, Err: ErrArchiveLimit}
+	}
+	if strings.HasSuffix(name, "/") {
+		entry.mode |= fs.ModeDir
+	}
+	name = cleanMemberName(name)
+	if name == "" || !fs.ValidPath(name) {
+		return nil
+	}
+	entry.fullPath = name
+	if existing, ok := fsys.entries[name]; ok {
+		// an explicit directory member replaces the implied one but keeps its children, duplicates are ignored
+		if existing.IsDir() && entry.IsDir() {
+			entry.children = existing.children
+			*existing = *entry
+		}
+		return nil
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if parent, ok := fsys.entries[dir]; ok && !parent.IsDir() {
+			return nil
+		}
+	}
+	fsys.entries[name] = entry
+	child := entry
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		parent, ok := fsys.entries[dir]
+		if !ok {
+			parent = &archiveEntry{fullPath: dir, mode: fs.ModeDir | 0755, modTime: entry.modTime}
+			fsys.entries[dir] = parent
+		}
+		parent.children = append(parent.children, child)
+		if ok || dir == "." {
+			return nil
+		}
+		child = parent
+	}
+}
+
+// cleanMemberName removes leading slashes, ./ and .. from a member name
+func cleanMemberName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// indexTar adds the files and directories of a tar or tar.gz archive
+func (fsys *ArchiveFS) indexTar() error {
+	reader, err := NewFileReader(fsys.filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	treader := tar.NewReader(reader)
+	for {
+		var header *tar.Header
+		if header, err = treader.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+		entry := &archiveEntry{size: header.Size, mode: header.FileInfo().Mode(), modTime: header.ModTime}
+		if err = fsys.add(header.Name, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the archive
+func (fsys *ArchiveFS) Close() error {
+	if fsys.zreader != nil {
+		return fsys.zreader.Close()
+	}
+	return nil
+}
+
+// Open opens a member, compressed members are decompressed on read
+func (fsys *ArchiveFS) Open(name string) (fs.File, error) {
+	entry, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.IsDir() {
+		return &archiveDir{entry: entry}, nil
+	}
+
+	var raw io.ReadCloser
+	if entry.zfile != nil {
+		if raw, err = entry.zfile.Open(); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	} else if raw, err = fsys.openTarMember(entry.fullPath); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	var reader *Reader
+	if reader, err = NewReader(raw); err != nil {
+		raw.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &archiveFile{entry: entry, reader: reader, remaining: fsys.opts.MaxMemberSize}, nil
+}
+
+// openTarMember scans a tar archive to a member and returns a reader of its content
+func (fsys *ArchiveFS) openTarMember(name string) (io.ReadCloser, error) {
+	reader, err := NewFileReader(fsys.filename)
+	if err != nil {
+		return nil, err
+	}
+	treader := tar.NewReader(reader)
+	for {
+		var header *tar.Header
+		if header, err = treader.Next(); err != nil {
+			reader.Close()
+			if err == io.EOF {
+				err = fs.ErrNotExist
+			}
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && cleanMemberName(header.Name) == name {
+			return struct {
+				io.Reader
+				io.Closer
+			}{treader, reader}, nil
+		}
+	}
+}
+
+// Stat returns the file info of a member
+func (fsys *ArchiveFS) Stat(name string) (fs.FileInfo, error) {
+	entry, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ReadDir returns the entries of a directory sorted by name
+func (fsys *ArchiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	list := make([]fs.DirEntry, len(entry.children))
+	for i, child := range entry.children {
+		list[i] = child
+	}
+	return list, nil
+}
+
+// Glob returns the names of members matching pattern
+func (fsys *ArchiveFS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var matches []string
+	for name := range fsys.entries {
+		if matched, _ := path.Match(pattern, name); matched && name != "." {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// WalkDir walks members under root, see fs.WalkDir
+func (fsys *ArchiveFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return fs.WalkDir(fsys, root, fn)
+}
+
+// lookup validates a name and returns its entry
+func (fsys *ArchiveFS) lookup(op string, name string) (*archiveEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := fsys.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+// Name returns the base name
+func (e *archiveEntry) Name() string { return path.Base(e.fullPath) }
+
+// Size returns the size stored in the archive, which is the compressed size for compressed members
+func (e *archiveEntry) Size() int64 { return e.size }
+
+// Mode returns the file mode
+func (e *archiveEntry) Mode() fs.FileMode { return e.mode }
+
+// ModTime returns the modification time
+func (e *archiveEntry) ModTime() time.Time { return e.modTime }
+
+// IsDir returns true for directories
+func (e *archiveEntry) IsDir() bool { return e.mode.IsDir() }
+
+// Sys returns the zip header of zip members
+func (e *archiveEntry) Sys() interface{} {
+	if e.zfile != nil {
+		return &e.zfile.FileHeader
+	}
+	return nil
+}
+
+// Type returns the type bits of the mode
+func (e *archiveEntry) Type() fs.FileMode { return e.mode.Type() }
+
+// Info returns the entry itself
+func (e *archiveEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+// archiveFile is an open member, reads fail with ErrArchiveLimit past the member size limit
+type archiveFile struct {
+	entry     *archiveEntry
+	reader    *Reader
+	remaining int64
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+
+func (f *archiveFile) Read(p []byte) (int, error) {
+	if f.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.entry.fullPath, Err: fs.ErrClosed}
+	}
+	if int64(len(p)) > f.remaining+1 {
+		p = p[:f.remaining+1]
+	}
+	n, err := f.reader.Read(p)
+	if int64(n) > f.remaining {
+		n = int(f.remaining)
+		f.remaining = 0
+		return n, &fs.PathError{Op: "read", Path: f.entry.fullPath, Err: ErrArchiveLimit}
+	}
+	f.remaining -= int64(n)
+	return n, err
+}
+
+func (f *archiveFile) Close() error {
+	if f.reader == nil {
+		return &fs.PathError{Op: "close", Path: f.entry.fullPath, Err: fs.ErrClosed}
+	}
+	err := f.reader.Close()
+	f.reader = nil
+	return err
+}
+
+// archiveDir is an open directory
+type archiveDir struct {
+	entry  *archiveEntry
+	offset int
+}
+
+func (d *archiveDir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+
+func (d *archiveDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.fullPath, Err: errors.New("is a directory")}
+}
+
+func (d *archiveDir) Close() error { return nil }
+
+// ReadDir returns up to n entries, or all remaining entries if n <= 0
+func (d *archiveDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	children := d.entry.children[d.offset:]
+	if n > 0 && len(children) > n {
+		children = children[:n]
+	}
+	if n > 0 && len(children) == 0 {
+		return nil, io.EOF
+	}
+	list := make([]fs.DirEntry, len(children))
+	for i, child := range children {
+		list[i] = child
+	}
+	d.offset += len(children)
+	return list, nil
+}
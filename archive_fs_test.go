@@ -0,0 +1,148 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// archive_fs_test.go
+
+package gox
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func createTestTarGz(t *testing.T, filename string, members map[string]string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "./logs/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Now()})
+	for name, data := range members {
+		header := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+		if err = tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	gz.Close()
+}
+
+func TestArchiveFSZip(t *testing.T) {
+	filename := os.TempDir() + "/gox-archive-fs.zip"
+	createTestArchive(t, filename)
+	defer os.Remove(filename)
+
+	fsys, err := NewArchiveFS(filename, ArchiveFSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+	if err = fstest.TestFS(fsys, "logs/mongod.log.gz", "getMongoData.json", "export/users.csv"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := fs.ReadFile(fsys, "logs/mongod.log.gz")
+	if err != nil || !strings.HasPrefix(string(b), `{"t":{"$date"`) {
+		t.Errorf("nested gzip member should be decompressed, got %q %v", b, err)
+	}
+	matches, err := fs.Glob(fsys, "logs/mongo*.log*")
+	if err != nil || len(matches) != 3 {
+		t.Errorf("unexpected glob %v %v", matches, err)
+	}
+	count := 0
+	fsys.WalkDir(".", func(name string, d fs.DirEntry, err error) error {
+		if !d.IsDir() {
+			count++
+		}
+		return err
+	})
+	if count != 6 {
+		t.Errorf("expected 6 files, got %d", count)
+	}
+	if _, err = fsys.Open("../etc/passwd"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("expected invalid path error, got %v", err)
+	}
+	if _, err = fsys.Open("missing.log"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestArchiveFSTarGz(t *testing.T) {
+	filename := os.TempDir() + "/gox-archive-fs.tar.gz"
+	var gzlog strings.Builder
+	gz := gzip.NewWriter(&gzlog)
+	gz.Write([]byte("rotated line\n"))
+	gz.Close()
+	createTestTarGz(t, filename, map[string]string{
+		"./logs/mongod.log":      "current line\n",
+		"./logs/mongod.log.2.gz": gzlog.String(),
+		"/etc/mongod.conf":       "net:\n  port: 27017\n",
+	})
+	defer os.Remove(filename)
+
+	fsys, err := NewArchiveFS(filename, ArchiveFSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+	if err = fstest.TestFS(fsys, "logs/mongod.log", "logs/mongod.log.2.gz", "etc/mongod.conf"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"logs/mongod.log", "current line\n"},
+		{"logs/mongod.log.2.gz", "rotated line\n"},
+		{"etc/mongod.conf", "net:\n  port: 27017\n"},
+	}
+	for _, tc := range tests {
+		if b, err := fs.ReadFile(fsys, tc.name); err != nil || string(b) != tc.expected {
+			t.Errorf("ReadFile(%q) = %q %v, expected %q", tc.name, b, err, tc.expected)
+		}
+	}
+}
+
+func TestArchiveFSLimits(t *testing.T) {
+	filename := os.TempDir() + "/gox-archive-fs-bomb.zip"
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	writer := zip.NewWriter(file)
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		w, _ := writer.Create(name)
+		w.Write([]byte(strings.Repeat("0", 64*1024)))
+	}
+	writer.Close()
+	file.Close()
+
+	if _, err = NewArchiveFS(filename, ArchiveFSOptions{MaxMembers: 2}); !errors.Is(err, ErrArchiveLimit) {
+		t.Errorf("expected member count limit, got %v", err)
+	}
+	fsys, err := NewArchiveFS(filename, ArchiveFSOptions{MaxMemberSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+	f, err := fsys.Open("a.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n, err := io.Copy(io.Discard, f)
+	if !errors.Is(err, ErrArchiveLimit) || n != 1024 {
+		t.Errorf("expected member size limit after 1024 bytes, got %d %v", n, err)
+	}
+}
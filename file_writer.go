@@ -0,0 +1,157 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// file_writer.go
+
+package gox
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the format written by a FileWriter
+type Compression int
+
+const (
+	// CompressionAuto selects the format from the file extension
+	CompressionAuto Compression = iota
+	// CompressionNone writes plain data
+	CompressionNone
+	// CompressionGzip writes gzip, .gz and .tgz
+	CompressionGzip
+	// CompressionZstd writes zstd, .zst and .zstd
+	CompressionZstd
+	// CompressionSnappy writes framed snappy, .sz and .snappy
+	CompressionSnappy
+)
+
+// CompressionFromExt returns the compression of a file name by its extension
+func CompressionFromExt(filename string) Compression {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gz", ".tgz":
+		return CompressionGzip
+	case ".zst", ".zstd":
+		return CompressionZstd
+	case ".sz", ".snappy":
+		return CompressionSnappy
+	}
+	return CompressionNone
+}
+
+// FileWriterOptions defines the format and permissions of a FileWriter
+type FileWriterOptions struct {
+	Compression Compression // Format, by file extension if CompressionAuto
+	Level       int         // Compression level, gzip 1-9 or zstd 1-22, the default of the format if 0
+	Mode        os.FileMode // Permissions, 0644 if 0
+}
+
+// FileWriter streams compressed data into a temporary file that is renamed to the file name on Close
+// Readers never see partial output, and the file is left untouched if writing fails
+type FileWriter struct {
+	filename string
+	mode     os.FileMode
+	file     *os.File
+	writer   io.WriteCloser
+}
+
+// NewFileWriter returns a writer of a gzip, zstd, snappy or plain file
+func NewFileWriter(filename string, opts FileWriterOptions) (*FileWriter, error) {
+	var err error
+	if opts.Compression == CompressionAuto {
+		opts.Compression = CompressionFromExt(filename)
+	}
+	if opts.Mode == 0 {
+		opts.Mode = 0644
+	}
+	w := &FileWriter{filename: filename, mode: opts.Mode}
+	if w.file, err = os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-"); err != nil {
+		return nil, err
+	}
+	if w.writer, err = newCompressWriter(w.file, opts.Compression, opts.Level); err != nil {
+		w.file.Close()
+		os.Remove(w.file.Name())
+		return nil, err
+	}
+	return w, nil
+}
+
+// newCompressWriter returns a compressing writer that does not close w
+func newCompressWriter(w io.Writer, compression Compression, level int) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case CompressionZstd:
+		zopts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != 0 {
+			zopts = append(zopts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, zopts...)
+	case CompressionSnappy:
+		return snappy.NewBufferedWriter(w), nil
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, errors.New("unknown compression")
+}
+
+// Write compresses p into the temporary file
+func (w *FileWriter) Write(p []byte) (int, error) {
+	if w.writer == nil {
+		return 0, os.ErrClosed
+	}
+	return w.writer.Write(p)
+}
+
+// Close flushes the compressor and renames the temporary file to the file name
+func (w *FileWriter) Close() error {
+	if w.writer == nil {
+		return os.ErrClosed
+	}
+	err := w.writer.Close()
+	w.writer = nil
+	if err == nil {
+		err = w.file.Chmod(w.mode)
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(w.file.Name(), w.filename)
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+	}
+	return err
+}
+
+// Abort discards what was written and leaves the file untouched
+func (w *FileWriter) Abort() error {
+	if w.writer == nil {
+		return os.ErrClosed
+	}
+	w.writer = nil
+	w.file.Close()
+	return os.Remove(w.file.Name())
+}
+
+// outputFile writes b to a file atomically with a compression
+func outputFile(b []byte, filename string, compression Compression) error {
+	w, err := NewFileWriter(filename, FileWriterOptions{Compression: compression})
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(b); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
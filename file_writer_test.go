@@ -0,0 +1,88 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// file_writer_test.go
+
+package gox
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	data := strings.Repeat(`{"msg":"Slow query","attr":{"ns":"acme.orders"}}`+"\n", 1000)
+	tests := []struct {
+		name  string
+		opts  FileWriterOptions
+		magic func([]byte) bool
+	}{
+		{"export.json.gz", FileWriterOptions{}, IsGzip},
+		{"export.json.gz", FileWriterOptions{Level: 9}, IsGzip},
+		{"export.json.zst", FileWriterOptions{}, IsZstd},
+		{"export.json.zst", FileWriterOptions{Level: 19}, IsZstd},
+		{"export.json.sz", FileWriterOptions{}, IsSnappy},
+		{"export.json", FileWriterOptions{Compression: CompressionZstd}, IsZstd},
+		{"export.json", FileWriterOptions{Mode: 0600}, func(b []byte) bool { return b[0] == '{' }},
+	}
+	for _, tc := range tests {
+		filename := filepath.Join(dir, tc.name)
+		w, err := NewFileWriter(filename, tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(data); i += 4096 {
+			w.Write([]byte(data[i:min(i+4096, len(data))]))
+		}
+		if _, err = os.Stat(filename); err == nil {
+			os.Remove(filename)
+			t.Errorf("%s should not exist before Close", tc.name)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		b, _ := os.ReadFile(filename)
+		if !tc.magic(b) {
+			t.Errorf("%s %+v: unexpected format % x", tc.name, tc.opts, b[:4])
+		}
+		reader, err := NewFileReader(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ = io.ReadAll(reader); string(b) != data {
+			t.Errorf("%s %+v: content mismatch", tc.name, tc.opts)
+		}
+		reader.Close()
+		if info, _ := os.Stat(filename); tc.opts.Mode != 0 && info.Mode().Perm() != tc.opts.Mode {
+			t.Errorf("%s: expected mode %v, got %v", tc.name, tc.opts.Mode, info.Mode())
+		}
+		os.Remove(filename)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestFileWriterAbort(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "export.json")
+	os.WriteFile(filename, []byte("previous"), 0644)
+	w, err := NewFileWriter(filename, FileWriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("partial"))
+	if err = w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filename); string(b) != "previous" {
+		t.Errorf("Abort should leave the file untouched, got %q", b)
+	}
+	if _, err = w.Write([]byte("more")); err == nil {
+		t.Errorf("Write after Abort should fail")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(filename)); len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
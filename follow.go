@@ -0,0 +1,191 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// follow.go
+
+package gox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPollInterval is how often a Follower checks a file for new lines and rotation
+const DefaultPollInterval = 250 * time.Millisecond
+
+// FollowOptions defines where a Follower starts and how often it polls
+type FollowOptions struct {
+	Offset       int64         // Byte offset to resume from, such as a saved Checkpoint
+	Inode        uint64        // Inode of the file Offset belongs to, a different file is read from its beginning
+	FromEnd      bool          // Start at the end of the file instead of Offset, if the file exists
+	PollInterval time.Duration // Polling interval, DefaultPollInterval if 0
+}
+
+// FollowLine is a line read by a Follower
+type FollowLine struct {
+	Text   string // Line without the trailing newline
+	Offset int64  // Offset after the line, to resume from
+	Inode  uint64 // Inode of the file, to resume from with Offset, 0 if unknown
+}
+
+// Follower reads lines appended to a file like tail -F, reopening the file after rotation
+// A renamed file is read to its end before the new file at the same path is opened, a truncated file is read from
+// its beginning
+type Follower struct {
+	filename   string
+	opts       FollowOptions
+	checkpoint atomic.Int64
+	err        error
+}
+
+// NewFollower returns a follower of a file, which does not need to exist yet
+func NewFollower(filename string, opts FollowOptions) *Follower {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	f := &Follower{filename: filename, opts: opts}
+	f.checkpoint.Store(opts.Offset)
+	return f
+}
+
+// Checkpoint returns the offset after the last line received, in the file currently followed
+func (f *Follower) Checkpoint() int64 {
+	return f.checkpoint.Load()
+}
+
+// Err returns the error that stopped the follower, nil if stopped by its context
+func (f *Follower) Err() error {
+	return f.err
+}
+
+// Follow sends lines to the returned channel, which is closed when ctx is done or reading fails
+func (f *Follower) Follow(ctx context.Context) <-chan FollowLine {
+	lines := make(chan FollowLine)
+	go func() {
+		defer close(lines)
+		f.err = f.follow(ctx, lines)
+	}()
+	return lines
+}
+
+// follow reads and polls until ctx is done
+func (f *Follower) follow(ctx context.Context, lines chan<- FollowLine) error {
+	var err error
+	var file *os.File
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	var reader *bufio.Reader
+	var pending []byte
+	offset := f.opts.Offset
+	inode := f.opts.Inode
+	fromEnd := f.opts.FromEnd
+
+	// send sends complete lines until EOF, and the incomplete last line if final, it returns false if ctx is done
+	send := func(final bool) (bool, error) {
+		for {
+			line, err := reader.ReadSlice('\n')
+			pending = append(pending, line...)
+			if err == bufio.ErrBufferFull {
+				continue
+			} else if err != nil && err != io.EOF {
+				return false, err
+			} else if err == io.EOF && (!final || len(pending) == 0) {
+				return true, nil
+			}
+			offset += int64(len(pending))
+			select {
+			case lines <- FollowLine{Text: string(bytes.TrimRight(pending, "\r\n")), Offset: offset, Inode: inode}:
+				f.checkpoint.Store(offset)
+			case <-ctx.Done():
+				return false, nil
+			}
+			pending = pending[:0]
+		}
+	}
+
+	for {
+		if file == nil {
+			if file, err = os.Open(f.filename); err != nil && !os.IsNotExist(err) {
+				return err
+			} else if file == nil {
+				// a file created later is read from its beginning, like tail -F
+				offset, fromEnd = 0, false
+			} else {
+				if offset, inode, err = f.seek(file, offset, inode, fromEnd); err != nil {
+					return err
+				}
+				fromEnd = false
+				reader = bufio.NewReader(file)
+			}
+		}
+		if file != nil {
+			if ok, err := send(false); !ok || err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-time.After(f.opts.PollInterval):
+		case <-ctx.Done():
+			return nil
+		}
+
+		if file != nil {
+			var rotated bool
+			if rotated, err = f.rotated(file, offset+int64(len(pending))); err != nil {
+				return err
+			} else if rotated {
+				// finish the rotated file, then start over with the file now at the path
+				if ok, err := send(true); !ok || err != nil {
+					return err
+				}
+				file.Close()
+				file = nil
+				offset = 0
+			}
+		}
+	}
+}
+
+// seek positions a newly opened file and returns its inode, starting over when the offset is past the end of the
+// file or belongs to another inode, as after a rotation
+func (f *Follower) seek(file *os.File, offset int64, inode uint64, fromEnd bool) (int64, uint64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	current := fileInode(info)
+	if fromEnd {
+		offset = info.Size()
+	} else if offset > info.Size() || (inode != 0 && current != 0 && inode != current) {
+		offset = 0
+	}
+	f.checkpoint.Store(offset)
+	offset, err = file.Seek(offset, io.SeekStart)
+	return offset, current, err
+}
+
+// rotated returns true if the path now refers to another file, or the file shrank below what was read
+func (f *Follower) rotated(file *os.File, read int64) (bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() < read {
+		return true, nil
+	}
+	current, err := os.Stat(f.filename)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !os.SameFile(info, current), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// follow_test.go
+
+package gox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func appendFile(t *testing.T, filename string, data string) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(data)
+	file.Close()
+}
+
+func receiveLine(t *testing.T, lines <-chan FollowLine, expected string) FollowLine {
+	select {
+	case line := <-lines:
+		if line.Text != expected {
+			t.Fatalf("expected %q, got %q", expected, line.Text)
+		}
+		return line
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %q", expected)
+	}
+	return FollowLine{}
+}
+
+func TestFollower(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mongod.log")
+	appendFile(t, filename, "old line\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	follower := NewFollower(filename, FollowOptions{FromEnd: true, PollInterval: 10 * time.Millisecond})
+	lines := follower.Follow(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, filename, "line 1\r\nline ")
+	receiveLine(t, lines, "line 1")
+	appendFile(t, filename, "2\n")
+	line := receiveLine(t, lines, "line 2")
+	if line.Offset != int64(len("old line\nline 1\r\nline 2\n")) || follower.Checkpoint() != line.Offset {
+		t.Errorf("unexpected offset %d, checkpoint %d", line.Offset, follower.Checkpoint())
+	}
+
+	// logRotate rename mode, the last line of the old file has no newline
+	appendFile(t, filename, "line 3")
+	os.Rename(filename, filename+".2024-06-15T10-00-00")
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, filename, "line 4\n")
+	receiveLine(t, lines, "line 3")
+	receiveLine(t, lines, "line 4")
+
+	// copytruncate
+	os.Truncate(filename, 0)
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, filename, "line 5\n")
+	if line = receiveLine(t, lines, "line 5"); line.Offset != 7 {
+		t.Errorf("expected offset 7 after truncation, got %d", line.Offset)
+	}
+
+	cancel()
+	for range lines {
+	}
+	if follower.Err() != nil {
+		t.Error(follower.Err())
+	}
+}
+
+func TestFollowerCheckpoint(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mongod.log")
+	appendFile(t, filename, "line 1\nline 2\nline 3\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	follower := NewFollower(filename, FollowOptions{Offset: 7, PollInterval: 10 * time.Millisecond})
+	lines := follower.Follow(ctx)
+	receiveLine(t, lines, "line 2")
+	receiveLine(t, lines, "line 3")
+
+	// an offset past the end of the file means it was rotated since the checkpoint
+	follower = NewFollower(filename, FollowOptions{Offset: 1000, PollInterval: 10 * time.Millisecond})
+	receiveLine(t, follower.Follow(ctx), "line 1")
+}
+
+func TestFollowerFromEndMissingFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mongod.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := NewFollower(filename, FollowOptions{FromEnd: true, PollInterval: 10 * time.Millisecond}).Follow(ctx)
+
+	// a file created after the start is read from its beginning
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, filename, "line 1\nline 2\n")
+	receiveLine(t, lines, "line 1")
+	receiveLine(t, lines, "line 2")
+}
+
+func TestFollowerCheckpointInode(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mongod.log")
+	appendFile(t, filename, "line 1\nline 2\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	line := receiveLine(t, NewFollower(filename, FollowOptions{PollInterval: 10 * time.Millisecond}).Follow(ctx), "line 1")
+	if line.Inode == 0 {
+		t.Skip("inodes are not available")
+	}
+
+	// resuming from the same file continues at the offset
+	opts := FollowOptions{Offset: line.Offset, Inode: line.Inode, PollInterval: 10 * time.Millisecond}
+	receiveLine(t, NewFollower(filename, opts).Follow(ctx), "line 2")
+
+	// the file was rotated and the new one has grown past the offset since the checkpoint
+	os.Rename(filename, filename+".1")
+	appendFile(t, filename, "new 1\nnew 2\n")
+	receiveLine(t, NewFollower(filename, opts).Follow(ctx), "new 1")
+}
@@ -2,4 +2,7 @@ module github.com/simagix/gox
 
 go 1.25
 
-require github.com/golang/snappy v1.0.0
+require (
+	github.com/golang/snappy v1.0.0
+	github.com/klauspost/compress v1.18.0
+)
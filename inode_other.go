@@ -0,0 +1,13 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// inode_other.go
+
+//go:build !unix
+
+package gox
+
+import "os"
+
+// fileInode returns 0, inodes are not available on this platform
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
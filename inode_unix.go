@@ -0,0 +1,19 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// inode_unix.go
+
+//go:build unix
+
+package gox
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode of a file, 0 if unknown
+func fileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
@@ -6,53 +6,191 @@ import (
 	"archive/zip"
 	"bufio"
 	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
+	"iter"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
 )
 
-// NewFileReader returns a reader from either a gzip or plain file
-func NewFileReader(filename string) (*bufio.Reader, error) {
+// Reader is a buffered reader of decompressed content
+// Close closes the decompressor and the underlying reader if it is an io.Closer
+type Reader struct {
+	*bufio.Reader
+	closers []io.Closer
+}
+
+// Close closes the decompressor and then the underlying reader
+func (r *Reader) Close() error {
+	var err error
+	for _, closer := range r.closers {
+		if cerr := closer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	r.closers = nil
+	return err
+}
+
+// closerFunc adapts a function to io.Closer
+type closerFunc func() error
+
+// Close calls f
+func (f closerFunc) Close() error { return f() }
+
+// NewFileReader returns a reader from a gzip, zstd, snappy or plain file
+// A .sz or .snappy file without the framing format magic is read as a raw snappy block
+// Closing the reader closes the file
+func NewFileReader(filename string) (*Reader, error) {
+	return newFileReader(filename, nil)
+}
+
+// newFileReader returns a reader as NewFileReader, reading the file through wrap if not nil
+func newFileReader(filename string, wrap func(io.Reader) io.Reader) (*Reader, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
-	return NewReader(file)
+	var r io.Reader = file
+	if wrap != nil {
+		r = wrap(file)
+	}
+	reader, err := newReader(r, hasSnappyExt(filename))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if wrap != nil {
+		reader.closers = append(reader.closers, file)
+	}
+	return reader, nil
 }
 
-// NewReader returns a reader from either a gzip or plain file
-func NewReader(file *os.File) (*bufio.Reader, error) {
+// maxRawSnappySize is the largest raw snappy block read, raw blocks are decoded in memory
+const maxRawSnappySize = 64 * 1024 * 1024
+
+// NewReader returns a reader from gzip, zstd, snappy, bzip2 or plain content
+// Compression is detected from peeked bytes so that it works without seeking, such as on pipes and HTTP bodies
+// Concatenated gzip members and zstd frames are read as one stream, xz and lz4 are detected but not supported
+// Raw snappy blocks have no magic bytes and are only read by NewFileReader
+func NewReader(r io.Reader) (*Reader, error) {
+	return newReader(r, false)
+}
+
+// newReader returns a reader as NewReader, decoding content without a detected format as a raw snappy block if
+// rawSnappy is true
+func newReader(r io.Reader, rawSnappy bool) (*Reader, error) {
 	var buf []byte
 	var err error
-	var reader *bufio.Reader
 
-	reader = bufio.NewReader(file)
-	if buf, err = reader.Peek(10); err != nil {
-		return reader, err
+	reader := &Reader{Reader: bufio.NewReader(r)}
+	if closer, ok := r.(io.Closer); ok {
+		reader.closers = append(reader.closers, closer)
+	}
+	if buf, err = reader.Peek(10); err != nil && err != io.EOF {
+		return nil, err
 	}
-	file.Seek(0, 0)
-	bs, err := hex.DecodeString("ff060000734e61507059")
-	if string(bs) == string(buf) {
-		reader = bufio.NewReader(snappy.NewReader(file))
-	} else if buf[0] == 31 && buf[1] == 139 {
+	if IsSnappy(buf) {
+		reader.Reader = bufio.NewReader(snappy.NewReader(reader.Reader))
+	} else if IsGzip(buf) {
 		var zreader *gzip.Reader
-		if zreader, err = gzip.NewReader(file); err != nil {
-			return reader, err
+		if zreader, err = gzip.NewReader(reader.Reader); err != nil {
+			return nil, err
+		}
+		reader.Reader = bufio.NewReader(zreader)
+		reader.closers = append([]io.Closer{zreader}, reader.closers...)
+	} else if IsZstd(buf) {
+		var zreader *zstd.Decoder
+		if zreader, err = zstd.NewReader(reader.Reader, zstd.WithDecoderConcurrency(1)); err != nil {
+			return nil, err
+		}
+		reader.Reader = bufio.NewReader(zreader)
+		reader.closers = append([]io.Closer{closerFunc(func() error { zreader.Close(); return nil })}, reader.closers...)
+	} else if IsBzip2(buf) {
+		reader.Reader = bufio.NewReader(bzip2.NewReader(reader.Reader))
+	} else if IsXz(buf) {
+		return nil, errors.New("unsupported compression: xz")
+	} else if IsLz4(buf) {
+		return nil, errors.New("unsupported compression: lz4")
+	} else if rawSnappy {
+		data, err := io.ReadAll(io.LimitReader(reader.Reader, int64(snappy.MaxEncodedLen(maxRawSnappySize))+1))
+		if err != nil {
+			return nil, err
+		}
+		if size, err := snappy.DecodedLen(data); err != nil {
+			return nil, err
+		} else if size > maxRawSnappySize {
+			return nil, fmt.Errorf("raw snappy block of %d bytes exceeds %d bytes", size, maxRawSnappySize)
+		}
+		decoded, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, err
 		}
-		reader = bufio.NewReader(zreader)
-	} else {
-		reader = bufio.NewReader(file)
+		reader.Reader = bufio.NewReader(bytes.NewReader(decoded))
 	}
 
 	return reader, nil
 }
 
-// CountLines count number of '\n'
-func CountLines(reader *bufio.Reader) (int, error) {
+// hasSnappyExt returns true for a .sz or .snappy file name
+func hasSnappyExt(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".sz" || ext == ".snappy"
+}
+
+// IsGzip checks gzip magic bytes
+func IsGzip(buf []byte) bool {
+	return len(buf) >= 2 && buf[0] == 31 && buf[1] == 139
+}
+
+// IsZstd checks zstd frame magic bytes
+func IsZstd(buf []byte) bool {
+	return bytes.HasPrefix(buf, []byte{0x28, 0xb5, 0x2f, 0xfd})
+}
+
+// IsSnappy checks snappy framing format magic bytes
+func IsSnappy(buf []byte) bool {
+	bs, _ := hex.DecodeString("ff060000734e61507059")
+	return bytes.HasPrefix(buf, bs)
+}
+
+// IsBzip2 checks bzip2 magic bytes, BZh followed by the block size
+func IsBzip2(buf []byte) bool {
+	return len(buf) >= 4 && bytes.HasPrefix(buf, []byte("BZh")) && buf[3] >= '1' && buf[3] <= '9'
+}
+
+// IsXz checks xz magic bytes
+func IsXz(buf []byte) bool {
+	return bytes.HasPrefix(buf, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00})
+}
+
+// IsLz4 checks lz4 frame and legacy frame magic bytes
+func IsLz4(buf []byte) bool {
+	return bytes.HasPrefix(buf, []byte{0x04, 0x22, 0x4d, 0x18}) || bytes.HasPrefix(buf, []byte{0x02, 0x21, 0x4c, 0x18})
+}
+
+// IsCompressed checks magic bytes of the formats detected by NewReader, except raw snappy blocks
+func IsCompressed(buf []byte) bool {
+	return IsGzip(buf) || IsZstd(buf) || IsSnappy(buf) || IsBzip2(buf) || IsXz(buf) || IsLz4(buf)
+}
+
+// IsZip checks zip local file header magic bytes
+func IsZip(buf []byte) bool {
+	return bytes.HasPrefix(buf, []byte("PK\x03\x04"))
+}
+
+// CountLines count number of '\n', see CountLinesParallel for large files
+func CountLines(reader io.Reader) (int, error) {
 	buf := make([]byte, 32*1024)
 	lineSep := []byte{'\n'}
 	lineCounts := 0
@@ -62,7 +200,7 @@ func CountLines(reader *bufio.Reader) (int, error) {
 
 		switch {
 		case err == io.EOF:
-			return lineCounts, err
+			return lineCounts, nil
 
 		case err != nil:
 			return lineCounts, err
@@ -70,89 +208,276 @@ func CountLines(reader *bufio.Reader) (int, error) {
 	}
 }
 
-// OutputGzipped writes doc to a gzipped file
-func OutputGzipped(b []byte, filename string) error {
-	var zbuf bytes.Buffer
-	var n int
+// DefaultMaxLineSize is the default longest line returned by a LineScanner
+const DefaultMaxLineSize = 16 * 1024 * 1024
+
+// DefaultTruncateMarker ends lines truncated by a LineScanner
+const DefaultTruncateMarker = "...(truncated)"
+
+// LineTooLongError is returned by a LineScanner for a line over MaxLineSize
+type LineTooLongError struct {
+	Line   int // Line number, starting at 1
+	Length int // Length of the line without the newline
+	Max    int // MaxLineSize
+}
+
+func (e *LineTooLongError) Error() string {
+	return fmt.Sprintf("line %d is %d bytes, over the %d bytes limit", e.Line, e.Length, e.Max)
+}
+
+// LineScannerOptions defines how a LineScanner handles long lines
+type LineScannerOptions struct {
+	MaxLineSize    int    // Longest line returned, DefaultMaxLineSize if 0
+	Truncate       bool   // Truncate long lines instead of stopping with a LineTooLongError
+	TruncateMarker string // Appended to truncated lines, DefaultTruncateMarker if empty
+}
+
+// LineScanner reads lines of any length up to a limit, unlike bufio.Scanner that stops at 64 KB
+// Lines are returned without \n or \r\n, including a last line without a newline
+type LineScanner struct {
+	reader *bufio.Reader
+	opts   LineScannerOptions
+	line   []byte
+	lineNo int
+	err    error
+}
+
+// NewLineScanner returns a line scanner, use NewReader first for compressed content
+func NewLineScanner(r io.Reader, opts LineScannerOptions) *LineScanner {
+	if opts.MaxLineSize <= 0 {
+		opts.MaxLineSize = DefaultMaxLineSize
+	}
+	if opts.TruncateMarker == "" {
+		opts.TruncateMarker = DefaultTruncateMarker
+	}
+	var reader *bufio.Reader
+	switch v := r.(type) {
+	case *Reader:
+		reader = v.Reader
+	case *bufio.Reader:
+		reader = v
+	default:
+		reader = bufio.NewReader(r)
+	}
+	return &LineScanner{reader: reader, opts: opts}
+}
+
+// Scan reads the next line, it returns false at the end or on an error
+func (s *LineScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	s.line = s.line[:0]
+	size := 0
+	var last byte // last byte of the previous fragment
+	var frag []byte
 	var err error
-	gz := gzip.NewWriter(&zbuf)
-	nw := 0
-	for nw < len(b) {
-		if n, err = gz.Write(b[nw:]); err != nil {
-			return err
+	for {
+		frag, err = s.reader.ReadSlice('\n')
+		size += len(frag)
+		// keep room for \r\n, the rest of a long line is discarded
+		if room := s.opts.MaxLineSize + 2 - len(s.line); room > 0 {
+			s.line = append(s.line, frag[:min(room, len(frag))]...)
 		}
-		nw += n
+		if err != bufio.ErrBufferFull {
+			break
+		}
+		last = frag[len(frag)-1]
+	}
+	if err != nil && err != io.EOF {
+		s.err = err
+		return false
+	} else if size == 0 {
+		return false
 	}
-	gz.Close() // flushing the bytes to the buffer.
-	return ioutil.WriteFile(filename, zbuf.Bytes(), 0644)
+	s.lineNo++
+
+	// a CR before the newline, or at the end, may be the last byte of the previous fragment
+	length := size
+	if err == nil {
+		length--
+		frag = frag[:len(frag)-1]
+	}
+	if (len(frag) > 0 && frag[len(frag)-1] == '\r') || (len(frag) == 0 && last == '\r') {
+		length--
+	}
+	if length <= s.opts.MaxLineSize {
+		s.line = s.line[:length]
+		return true
+	}
+	if !s.opts.Truncate {
+		s.err = &LineTooLongError{Line: s.lineNo, Length: length, Max: s.opts.MaxLineSize}
+		return false
+	}
+	s.line = append(s.line[:s.opts.MaxLineSize], s.opts.TruncateMarker...)
+	return true
 }
 
-// OutputSnappyZipped writes doc to a gzipped file
-func OutputSnappyZipped(b []byte, filename string) error {
-	var zbuf bytes.Buffer
-	var n int
-	var err error
-	snz := snappy.NewWriter(&zbuf)
-	nw := 0
-	for nw < len(b) {
-		if n, err = snz.Write(b[nw:]); err != nil {
-			return err
+// Bytes returns the line read by Scan, valid until the next Scan
+func (s *LineScanner) Bytes() []byte {
+	return s.line
+}
+
+// Text returns the line read by Scan as a string
+func (s *LineScanner) Text() string {
+	return string(s.line)
+}
+
+// LineNumber returns the number of the line read by Scan, starting at 1
+func (s *LineScanner) LineNumber() int {
+	return s.lineNo
+}
+
+// Err returns the error that stopped the scanner, nil at the end of the input
+func (s *LineScanner) Err() error {
+	return s.err
+}
+
+// All returns an iterator of line numbers and lines, check Err after the loop
+// A line is only valid until the next iteration
+func (s *LineScanner) All() iter.Seq2[int, []byte] {
+	return func(yield func(int, []byte) bool) {
+		for s.Scan() {
+			if !yield(s.lineNo, s.line) {
+				return
+			}
 		}
-		nw += n
 	}
-	snz.Close() // flushing the bytes to the buffer.
-	return ioutil.WriteFile(filename, zbuf.Bytes(), 0644)
 }
 
-// ReadAll reads from a file and return bytes
-func ReadAll(file *os.File) ([]byte, error) {
+// OutputGzipped writes doc to a gzipped file
+func OutputGzipped(b []byte, filename string) error {
+	return outputFile(b, filename, CompressionGzip)
+}
+
+// OutputSnappyZipped writes doc to a snappy compressed file
+func OutputSnappyZipped(b []byte, filename string) error {
+	return outputFile(b, filename, CompressionSnappy)
+}
+
+// OutputZstd writes doc to a zstd compressed file
+func OutputZstd(b []byte, filename string) error {
+	return outputFile(b, filename, CompressionZstd)
+}
+
+// ReadAll reads and decompresses all bytes from a reader, such as a file
+func ReadAll(r io.Reader) ([]byte, error) {
 	var err error
 	var b []byte
-	var reader *bufio.Reader
+	var reader *Reader
 
-	if reader, err = NewReader(file); err != nil {
+	if reader, err = NewReader(r); err != nil {
 		return b, err
 	}
 
 	return ioutil.ReadAll(reader)
 }
 
-// ZipFiles zips files into a zip archive
+// ZipOptions defines how files are added to a zip archive
+type ZipOptions struct {
+	BaseDir string                   // Member names are relative to BaseDir, or cleaned file names if empty
+	Method  func(name string) uint16 // Compression method of a member, ZipMethod if nil
+}
+
+// ZipMethod stores already compressed files and deflates others
+func ZipMethod(name string) uint16 {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gz", ".tgz", ".zst", ".sz", ".snappy", ".zip", ".bz2", ".xz", ".lz4":
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// ZipFiles zips files and directories, recursively, into a zip archive
 func ZipFiles(zipFilename string, filenames []string) error {
 	var err error
 	var zipFile *os.File
-	var file *os.File
-	var info os.FileInfo
-	var header *zip.FileHeader
 
 	if zipFile, err = os.Create(zipFilename); err != nil {
 		return err
 	}
-	defer zipFile.Close()
-
-	writer := zip.NewWriter(zipFile)
-	defer writer.Close()
+	if err = ZipFilesTo(zipFile, filenames, ZipOptions{}); err != nil {
+		zipFile.Close()
+		return err
+	}
+	return zipFile.Close()
+}
 
+// ZipFilesTo streams a zip archive of files and directories, recursively, into a writer
+func ZipFilesTo(w io.Writer, filenames []string, opts ZipOptions) error {
+	var err error
+	if opts.Method == nil {
+		opts.Method = ZipMethod
+	}
+	writer := zip.NewWriter(w)
 	for _, filename := range filenames {
-		if file, err = os.Open(filename); err != nil {
+		err = filepath.WalkDir(filename, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			return addZipFile(writer, name, opts)
+		})
+		if err != nil {
+			writer.Close()
 			return err
 		}
-		defer file.Close()
-		if info, err = file.Stat(); err != nil {
-			return err
-		}
-		if header, err = zip.FileInfoHeader(info); err != nil {
-			return err
+	}
+	return writer.Close()
+}
+
+// addZipFile adds a file to a zip archive and closes it, files that are not regular are skipped
+func addZipFile(writer *zip.Writer, filename string, opts ZipOptions) error {
+	var err error
+	var file *os.File
+	var info os.FileInfo
+	var header *zip.FileHeader
+
+	if file, err = os.Open(filename); err != nil {
+		return err
+	}
+	defer file.Close()
+	if info, err = file.Stat(); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	if header, err = zip.FileInfoHeader(info); err != nil {
+		return err
+	}
+	if header.Name, err = zipMemberName(filename, opts.BaseDir); err != nil {
+		return err
+	}
+	header.Method = opts.Method(filename)
+	return addZipEntry(writer, header, file)
+}
+
+// zipMemberName returns a relative slash separated name without volume, leading slashes or ..
+func zipMemberName(filename string, baseDir string) (string, error) {
+	if baseDir != "" {
+		var err error
+		var abs, base string
+		if abs, err = filepath.Abs(filename); err != nil {
+			return "", err
 		}
-		header.Name = filename
-		header.Method = zip.Deflate
-		var w io.Writer
-		if w, err = writer.CreateHeader(header); err != nil {
-			return err
+		if base, err = filepath.Abs(baseDir); err != nil {
+			return "", err
 		}
-		if _, err = io.Copy(w, file); err != nil {
-			return err
+		if filename, err = filepath.Rel(base, abs); err != nil {
+			return "", err
 		}
 	}
-	return nil
+	filename = filename[len(filepath.VolumeName(filename)):]
+	return cleanMemberName(filepath.ToSlash(filename)), nil
+}
+
+// addZipEntry writes an entry to a zip archive
+func addZipEntry(writer *zip.Writer, header *zip.FileHeader, reader io.Reader) error {
+	var err error
+	var w io.Writer
+	if w, err = writer.CreateHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, reader)
+	return err
 }
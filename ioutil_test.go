@@ -3,13 +3,21 @@
 package gox
 
 import (
+	"archive/zip"
 	"bufio"
+	"bytes"
 	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestNewFileReader(t *testing.T) {
@@ -67,6 +75,199 @@ func TestNewReader(t *testing.T) {
 		t.Fatal(str, string(buf))
 	}
 	os.Remove(filename)
+
+	filename = "keyhole.zst"
+	OutputZstd([]byte(str), filename)
+	zstdreader, err := NewFileReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _, err = zstdreader.ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str != string(buf) {
+		t.Fatal(str, string(buf))
+	}
+	os.Remove(filename)
+}
+
+func TestNewReaderStream(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("keyhole\n"))
+	zw.Close()
+
+	// a pipe cannot seek, so detection must rely on peeked bytes only
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(buf.Bytes())
+		pw.Close()
+	}()
+	reader, err := NewReader(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, _, err := reader.ReadLine()
+	if err != nil || string(line) != "keyhole" {
+		t.Fatal(string(line), err)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err = NewReader(strings.NewReader("plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(reader); string(b) != "plain" {
+		t.Fatal(string(b))
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	filename := "/tmp/close.file.zst"
+	if err := OutputZstd([]byte("keyhole"), filename); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = file.Read(make([]byte, 1)); err == nil {
+		t.Fatal("underlying file should be closed")
+	}
+}
+
+func TestNewReaderFormats(t *testing.T) {
+	var gzbuf bytes.Buffer
+	for _, member := range []string{"first member\n", "second member\n"} {
+		zw := gzip.NewWriter(&gzbuf)
+		zw.Write([]byte(member))
+		zw.Close()
+	}
+	var zstbuf bytes.Buffer
+	for _, frame := range []string{"first frame\n", "second frame\n"} {
+		zw, _ := zstd.NewWriter(&zstbuf)
+		zw.Write([]byte(frame))
+		zw.Close()
+	}
+	bz2, _ := os.ReadFile("testdata/connection.log.bz2")
+	long := strings.Repeat("2024-06-15T10:00:00.000+0000 I NETWORK connection accepted\n", 1000)
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{"multi-stream gzip", gzbuf.Bytes(), "first member\nsecond member\n"},
+		{"concatenated zstd", zstbuf.Bytes(), "first frame\nsecond frame\n"},
+		{"bzip2", bz2, "connection accepted from 192.168.1.100:51234\nsecond stream\n"},
+		{"raw snappy block is not sniffed", snappy.Encode(nil, []byte(long)), string(snappy.Encode(nil, []byte(long)))},
+		{"plain text like a snappy block", []byte("2024-06-15 plain\n"), "2024-06-15 plain\n"},
+		{"long plain text", []byte(long), long},
+		{"empty", []byte{}, ""},
+	}
+	for _, tc := range tests {
+		reader, err := NewReader(bytes.NewReader(tc.input))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if b, err := io.ReadAll(reader); err != nil || string(b) != tc.expected {
+			t.Errorf("%s: got %d bytes %v, expected %d bytes", tc.name, len(b), err, len(tc.expected))
+		}
+	}
+
+	xz, _ := os.ReadFile("testdata/connection.log.xz")
+	for _, tc := range []struct {
+		input    []byte
+		expected string
+	}{
+		{xz, "unsupported compression: xz"},
+		{[]byte{0x04, 0x22, 0x4d, 0x18, 0x64, 0x40, 0xa7}, "unsupported compression: lz4"},
+	} {
+		if _, err := NewReader(bytes.NewReader(tc.input)); err == nil || err.Error() != tc.expected {
+			t.Errorf("expected %q, got %v", tc.expected, err)
+		}
+	}
+}
+
+func TestNewReaderPipe(t *testing.T) {
+	// a line that could start a raw snappy block is read without waiting for more input
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("\x10\x00 first line\n"))
+	reader, err := NewReader(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line, err := reader.ReadString('\n'); err != nil || line != "\x10\x00 first line\n" {
+		t.Errorf("unexpected line %q, %v", line, err)
+	}
+}
+
+func TestNewFileReaderRawSnappy(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("2024-06-15T10:00:00.000+0000 I NETWORK connection accepted\n", 1000)
+	raw := filepath.Join(dir, "mongod.log.sz")
+	os.WriteFile(raw, snappy.Encode(nil, []byte(long)), 0644)
+	framed := filepath.Join(dir, "mongod.log.snappy")
+	OutputSnappyZipped([]byte(long), framed)
+	for _, filename := range []string{raw, framed} {
+		reader, err := NewFileReader(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, err := io.ReadAll(reader); err != nil || string(b) != long {
+			t.Errorf("%s: got %d bytes %v, expected %d bytes", filename, len(b), err, len(long))
+		}
+		reader.Close()
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.sz")
+	os.WriteFile(corrupt, []byte("2024-06-15 plain\n"), 0644)
+	if _, err := NewFileReader(corrupt); err == nil {
+		t.Error("expected an error for a .sz file that is not snappy")
+	}
+}
+
+func TestCompressionMagic(t *testing.T) {
+	tests := []struct {
+		buf      []byte
+		detect   func([]byte) bool
+		expected bool
+	}{
+		{[]byte{0x1f, 0x8b, 0x08}, IsGzip, true},
+		{[]byte{0x1f}, IsGzip, false},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x04}, IsZstd, true},
+		{[]byte{0x28, 0xb5, 0x2f}, IsZstd, false},
+		{[]byte("\xff\x06\x00\x00sNaPpY"), IsSnappy, true},
+		{[]byte("PK\x03\x04"), IsZip, true},
+		{[]byte("keyhole"), IsZip, false},
+		{[]byte("BZh91AY&SY"), IsBzip2, true},
+		{[]byte("BZh0"), IsBzip2, false},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, IsXz, true},
+		{[]byte{0x04, 0x22, 0x4d, 0x18}, IsLz4, true},
+		{[]byte{0x02, 0x21, 0x4c, 0x18}, IsLz4, true},
+		{[]byte("BZh91AY&SY"), IsCompressed, true},
+		{[]byte("keyhole"), IsCompressed, false},
+	}
+	for _, tc := range tests {
+		if tc.detect(tc.buf) != tc.expected {
+			t.Errorf("unexpected detection of % x", tc.buf)
+		}
+	}
 }
 
 func TestCountLines(t *testing.T) {
@@ -87,10 +288,10 @@ func TestCountLines(t *testing.T) {
 	file, _ = os.Open(filename)
 	defer file.Close()
 	reader := bufio.NewReader(file)
-	count, _ := CountLines(reader)
+	count, err := CountLines(reader)
 
-	if count != total {
-		t.Fatal(count)
+	if count != total || err != nil {
+		t.Fatal(count, err)
 	}
 }
 
@@ -165,6 +366,42 @@ func TestOutputSnappyZipped(t *testing.T) {
 	}
 }
 
+func TestOutputZstd(t *testing.T) {
+	var err error
+	var b []byte
+	var zr *zstd.Decoder
+	var file *os.File
+	filename := "/tmp/filename.zst"
+	str := "This is a test line! "
+	for len(str) < (10 * 1024 * 1024) {
+		str += str
+	}
+	if err = OutputZstd([]byte(str), filename); err != nil {
+		t.Fatal(err)
+	}
+	if file, err = os.Open(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if zr, err = zstd.NewReader(file); err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	if b, err = ioutil.ReadAll(zr); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != str {
+		t.Fatal("zstd content mismatch")
+	}
+
+	if err = os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestReadAll(t *testing.T) {
 	var file *os.File
 	var zfile *os.File
@@ -194,3 +431,75 @@ func TestZipFiles(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestZipFilesTo(t *testing.T) {
+	var buf bytes.Buffer
+	wd, _ := os.Getwd()
+	parent := "../" + filepath.Base(wd) + "/ioutil.go"
+	abs := filepath.Join(t.TempDir(), "mongod.conf")
+	os.WriteFile(abs, []byte("net:\n"), 0644)
+	if err := ZipFilesTo(&buf, []string{"testdata", parent, abs}, ZipOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	zreader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]uint16{}
+	for _, f := range zreader.File {
+		names[f.Name] = f.Method
+	}
+	if _, ok := names["testdata/mapping_vectors.json"]; !ok {
+		t.Errorf("directories should be zipped recursively, got %v", names)
+	}
+	if _, ok := names[filepath.Base(wd)+"/ioutil.go"]; !ok {
+		t.Errorf("names should not contain .., got %v", names)
+	}
+	if _, ok := names[strings.TrimPrefix(filepath.ToSlash(abs), "/")]; !ok {
+		t.Errorf("names should be relative, got %v", names)
+	}
+	if ZipMethod("mongod.log.gz") != zip.Store || ZipMethod("mongod.log") != zip.Deflate {
+		t.Errorf("compressed files should be stored")
+	}
+}
+
+func TestLineScanner(t *testing.T) {
+	long := strings.Repeat("x", 100*1024)
+	edge := strings.Repeat("y", 4095) // the CR of CRLF ends the first 4 KB buffer
+	input := "first\r\n" + long + "\n" + edge + "\r\n\nlast\r"
+	tests := []struct {
+		opts     LineScannerOptions
+		expected []string
+		err      error
+	}{
+		{LineScannerOptions{}, []string{"first", long, edge, "", "last"}, nil},
+		{LineScannerOptions{MaxLineSize: 4095}, []string{"first"}, &LineTooLongError{Line: 2, Length: len(long), Max: 4095}},
+		{LineScannerOptions{MaxLineSize: 4095, Truncate: true},
+			[]string{"first", long[:4095] + DefaultTruncateMarker, edge, "", "last"}, nil},
+		{LineScannerOptions{MaxLineSize: 3, Truncate: true, TruncateMarker: "~"}, []string{"fir~", "xxx~", "yyy~", "", "las~"}, nil},
+	}
+	for _, tc := range tests {
+		scanner := NewLineScanner(strings.NewReader(input), tc.opts)
+		var lines []string
+		for n, line := range scanner.All() {
+			if n != len(lines)+1 {
+				t.Errorf("expected line number %d, got %d", len(lines)+1, n)
+			}
+			lines = append(lines, string(line))
+		}
+		if strings.Join(lines, "|") != strings.Join(tc.expected, "|") {
+			t.Errorf("with %+v got %d lines, expected %d", tc.opts, len(lines), len(tc.expected))
+		}
+		if fmt.Sprint(scanner.Err()) != fmt.Sprint(tc.err) {
+			t.Errorf("with %+v expected error %v, got %v", tc.opts, tc.err, scanner.Err())
+		}
+	}
+
+	var lineErr *LineTooLongError
+	scanner := NewLineScanner(strings.NewReader("ok\n"+long), LineScannerOptions{MaxLineSize: 10})
+	for scanner.Scan() {
+	}
+	if !errors.As(scanner.Err(), &lineErr) || lineErr.Line != 2 {
+		t.Errorf("expected LineTooLongError at line 2, got %v", scanner.Err())
+	}
+}
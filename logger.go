@@ -4,6 +4,7 @@ package gox
 
 import (
 	"fmt"
+	"io"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +27,8 @@ type Logger struct {
 
 	inMem bool
 	level int
+	mutex sync.Mutex // guards Logs and out
+	out   io.Writer
 }
 
 var instance *Logger
@@ -54,6 +57,13 @@ func (p *Logger) SetLoggerLevel(level int) {
 	p.level = level
 }
 
+// SetOutput sets where messages are printed, such as a RotatingWriter, stdout if nil
+func (p *Logger) SetOutput(w io.Writer) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.out = w
+}
+
 // Error adds and prints an error message
 func (p *Logger) Error(v ...interface{}) {
 	p.print("E", fmt.Sprint(v...), Error)
@@ -120,7 +130,13 @@ func (p *Logger) print(indicator string, message string, level int) {
 		return
 	}
 	str := fmt.Sprintf(`%v %v %v`, time.Now().Format(time.RFC3339), indicator, message)
-	fmt.Println(str)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.out != nil {
+		fmt.Fprintln(p.out, str)
+	} else {
+		fmt.Println(str)
+	}
 	if level < Info {
 		return
 	}
@@ -131,5 +147,7 @@ func (p *Logger) print(indicator string, message string, level int) {
 
 // Print prints all Logs
 func (p *Logger) Print() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 	return strings.Join(p.Logs, "\n")
 }
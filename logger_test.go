@@ -3,6 +3,10 @@
 package gox
 
 import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -79,3 +83,32 @@ func assertEqual(t *testing.T, a interface{}, b interface{}) {
 		t.Fatalf("%s != %s", a, b)
 	}
 }
+
+func TestSetOutput(t *testing.T) {
+	var buf bytes.Buffer
+	logger := GetLogger("TestSetOutput")
+	logger.SetOutput(&buf)
+	defer logger.SetOutput(nil)
+	logger.Warn("to the writer")
+	if !strings.HasSuffix(buf.String(), " W to the writer\n") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+func TestSetOutputConcurrent(t *testing.T) {
+	logger := GetLogger("TestSetOutputConcurrent")
+	defer logger.SetOutput(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			logger.SetOutput(io.Discard)
+		}()
+		go func() {
+			defer wg.Done()
+			logger.Warn("concurrent")
+		}()
+	}
+	wg.Wait()
+}
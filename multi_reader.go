@@ -0,0 +1,169 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// multi_reader.go
+
+package gox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ReTimestamp matches ISO 8601 timestamps of legacy and JSON mongo logs
+var ReTimestamp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`)
+
+// timestampLayouts are tried in order to parse a ReTimestamp match
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999-0700", "2006-01-02T15:04:05.999999999"}
+
+// MultiReaderOptions defines how files of a MultiReader are ordered
+type MultiReaderOptions struct {
+	OrderByTime bool // Order files by their first timestamp instead of as given
+	ScanLines   int  // Lines scanned for the first timestamp, 100 if 0
+}
+
+// MultiReader reads lines of files, which may be compressed, as one stream
+// Source and LineNumber tell where the last line came from
+type MultiReader struct {
+	filenames []string
+	index     int
+	reader    *Reader
+	line      []byte
+	lineNo    int
+}
+
+// NewMultiReader returns a reader of files and glob patterns, such as mongod.log*
+func NewMultiReader(patterns []string, opts MultiReaderOptions) (*MultiReader, error) {
+	var filenames []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		} else if len(matches) == 0 {
+			matches = []string{pattern} // opening it reports the error
+		}
+		filenames = append(filenames, matches...)
+	}
+	if opts.OrderByTime {
+		if opts.ScanLines <= 0 {
+			opts.ScanLines = 100
+		}
+		times := map[string]time.Time{}
+		for _, filename := range filenames {
+			t, err := FirstTimestamp(filename, opts.ScanLines)
+			if err != nil {
+				return nil, err
+			}
+			times[filename] = t
+		}
+		// files without timestamps keep their order after the others
+		sort.SliceStable(filenames, func(i, j int) bool {
+			ti, tj := times[filenames[i]], times[filenames[j]]
+			return !ti.IsZero() && (tj.IsZero() || ti.Before(tj))
+		})
+	}
+	return &MultiReader{filenames: filenames, index: -1}, nil
+}
+
+// FirstTimestamp returns the first timestamp within the first lines of a file, zero if none
+func FirstTimestamp(filename string, lines int) (time.Time, error) {
+	reader, err := NewFileReader(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer reader.Close()
+	for i := 0; i < lines; i++ {
+		line, err := reader.ReadSlice('\n')
+		if match := ReTimestamp.Find(line); match != nil {
+			for _, layout := range timestampLayouts {
+				if t, err := time.Parse(layout, string(match)); err == nil {
+					return t, nil
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil && err != bufio.ErrBufferFull {
+			return time.Time{}, err
+		}
+	}
+	return time.Time{}, nil
+}
+
+// Files returns the files in reading order
+func (m *MultiReader) Files() []string {
+	return m.filenames
+}
+
+// ReadLine returns the next line without the newline, or io.EOF after the last file
+// The line is only valid until the next call
+func (m *MultiReader) ReadLine() ([]byte, error) {
+	for {
+		if m.reader == nil {
+			if m.index+1 >= len(m.filenames) {
+				return nil, io.EOF
+			}
+			m.index++
+			m.lineNo = 0
+			reader, err := NewFileReader(m.filenames[m.index])
+			if err != nil {
+				return nil, err
+			}
+			m.reader = reader
+		}
+
+		m.line = m.line[:0]
+		var err error
+		for {
+			var buf []byte
+			buf, err = m.reader.ReadSlice('\n')
+			m.line = append(m.line, buf...)
+			if err != bufio.ErrBufferFull {
+				break
+			}
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", m.Position(), err)
+		}
+		if len(m.line) > 0 {
+			m.lineNo++
+			return bytes.TrimRight(m.line, "\r\n"), nil
+		}
+		// end of this file
+		m.reader.Close()
+		m.reader = nil
+	}
+}
+
+// Source returns the file of the last line read
+func (m *MultiReader) Source() string {
+	if m.index < 0 || m.index >= len(m.filenames) {
+		return ""
+	}
+	return m.filenames[m.index]
+}
+
+// LineNumber returns the line number of the last line read within its file
+func (m *MultiReader) LineNumber() int {
+	return m.lineNo
+}
+
+// Position returns file:line of the last line read, for error messages
+func (m *MultiReader) Position() string {
+	return fmt.Sprintf("%s:%d", m.Source(), m.lineNo)
+}
+
+// Close closes the file being read
+func (m *MultiReader) Close() error {
+	if m.reader == nil {
+		return nil
+	}
+	err := m.reader.Close()
+	m.reader = nil
+	m.index = len(m.filenames)
+	return err
+}
@@ -0,0 +1,62 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// multi_reader_test.go
+
+package gox
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiReader(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "mongod.log"),
+		[]byte(`{"t":{"$date":"2024-06-03T00:00:00.000+00:00"},"msg":"current 1"}`+"\n"+`{"msg":"current 2"}`), 0644)
+	OutputGzipped([]byte("2024-06-01T00:00:00.000+0000 I NETWORK oldest 1\r\noldest 2\n"),
+		filepath.Join(dir, "mongod.log.2024-06-01T00-00-00.gz"))
+	os.WriteFile(filepath.Join(dir, "mongod.log.2024-06-02T00-00-00"),
+		[]byte("no timestamp\n2024-06-02T00:00:00Z middle 2\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("no timestamps here\n"), 0644)
+
+	tests := []struct {
+		opts     MultiReaderOptions
+		expected []string
+	}{
+		{MultiReaderOptions{}, []string{"mongod.log:1", "mongod.log:2", "mongod.log.2024-06-01T00-00-00.gz:1",
+			"mongod.log.2024-06-01T00-00-00.gz:2", "mongod.log.2024-06-02T00-00-00:1", "mongod.log.2024-06-02T00-00-00:2",
+			"notes.txt:1"}},
+		{MultiReaderOptions{OrderByTime: true}, []string{"mongod.log.2024-06-01T00-00-00.gz:1",
+			"mongod.log.2024-06-01T00-00-00.gz:2", "mongod.log.2024-06-02T00-00-00:1", "mongod.log.2024-06-02T00-00-00:2",
+			"mongod.log:1", "mongod.log:2", "notes.txt:1"}},
+	}
+	for _, tc := range tests {
+		reader, err := NewMultiReader([]string{filepath.Join(dir, "mongod.log*"), filepath.Join(dir, "notes.txt")}, tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var positions []string
+		for {
+			line, err := reader.ReadLine()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasSuffix(string(line), "\r") {
+				t.Errorf("line should not end with CR: %q", line)
+			}
+			positions = append(positions, strings.TrimPrefix(reader.Position(), dir+string(filepath.Separator)))
+		}
+		reader.Close()
+		if strings.Join(positions, " ") != strings.Join(tc.expected, " ") {
+			t.Errorf("with %+v got %v, expected %v", tc.opts, positions, tc.expected)
+		}
+	}
+
+	if _, err := NewMultiReader([]string{filepath.Join(dir, "missing.log")}, MultiReaderOptions{OrderByTime: true}); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+}
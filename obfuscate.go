@@ -4,13 +4,22 @@
 package gox
 
 import (
+	"bytes"
+	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"hash/fnv"
+	"math"
+	"math/big"
+	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Pre-compiled regex patterns for PII detection
@@ -20,7 +29,7 @@ var (
 	ReIP     = regexp.MustCompile(`\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}`)
 	ReIPCIDR = regexp.MustCompile(`^\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}(/\d{1,2})?$`)
 	ReFQDN   = regexp.MustCompile(`([a-zA-Z0-9-]{1,63}\.)+[a-zA-Z]{2,63}`)
-	ReNS     = regexp.MustCompile(`[^@$.\n]*\.[^^@.\n]*([.][^^@.\n]*)?`)
+	ReNS     = regexp.MustCompile(`[^@$.\s\x00]*\.[^^@.\s\x00]*([.][^^@.\s\x00]*)?`)
 	ReDigit  = regexp.MustCompile("[0-9.]")
 	ReSSN    = regexp.MustCompile(`\d{3}-\d{2}-\d{4}`)
 	ReMAC    = regexp.MustCompile(`([0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}`)
@@ -28,6 +37,8 @@ var (
 	ReMRN    = regexp.MustCompile(`(?i)(mrn|acct|id)[:\s#]*\d{6,}`)
 	RePhone  = regexp.MustCompile(`(\+\d{1,3}[-.\s]?)?(\(?\d{3}\)?[-.\s]?)?\d{3}[-.\s]?\d{4}`)
 	ReCard   = regexp.MustCompile(`\d{4}[-\s]?\d{4}[-\s]?\d{4}[-\s]?\d{4}`)
+
+	reHostPort = regexp.MustCompile(`^[a-zA-Z0-9._-]+:\d+$`)
 )
 
 // City and flower names for human-readable obfuscation
@@ -66,29 +77,41 @@ const (
 	NameStyleReadable NameStyle = iota
 	// NameStyleHash uses hash-based prefixes (host-abc123)
 	NameStyleHash
+	// NameStyleLabel obfuscates hostnames label by label, keeping public suffixes (db1.prod.acme.com → x.y.z.com)
+	NameStyleLabel
 )
 
 // Obfuscator handles PII obfuscation with consistent mappings
 // Uses deterministic hashing so the same input always produces the same output
 type Obfuscator struct {
 	// Configuration
-	Coefficient float64   // Multiplier for numeric obfuscation (default 0.917)
-	DateOffset  int       // Days to shift dates (default -42)
-	IPStyle     IPStyle   // How to obfuscate IPs
-	NameStyle   NameStyle // How to obfuscate names
+	Coefficient         float64        // Multiplier for numeric obfuscation (default 0.917)
+	DateOffset          int            // Days to shift dates (default -42)
+	IPStyle             IPStyle        // How to obfuscate IPs
+	NameStyle           NameStyle      // How to obfuscate names
+	Audit               *AuditLog      // Optional audit trail of replacements
+	SecretKey           string         // Per-customer secret for derived settings and MappingV2 pseudonyms
+	MappingVersion      MappingVersion // Pseudonym derivation algorithm (default MappingV1), see MAPPING.md
+	KeepProviderDomains bool           // Keep cloud provider domains and regions with NameStyleLabel, such as *.mongodb.net
 
 	// Mapping caches for consistency
 	CardMap     map[string]string
+	CloudMap    map[string]string
 	HostnameMap map[string]string
 	IDMap       map[string]string
 	IntMap      map[int]int
 	IPMap       map[string]string
+	LabelMap    map[string]string
 	MACMap      map[string]string
 	NameMap     map[string]string
 	NumberMap   map[string]float64
+	PathMap     map[string]string
 	PhoneMap    map[string]string
 	ReplSetMap  map[string]string
 	SSNMap      map[string]string
+
+	taken    map[string]map[string]bool // pseudonyms in use by cache, to tell colliding inputs apart
+	shielded []string                   // placeholder values of ObfuscateString, reused across calls
 }
 
 // NewObfuscator creates a new Obfuscator with default settings
@@ -99,13 +122,16 @@ func NewObfuscator() *Obfuscator {
 		IPStyle:     IPStyleKeepEnds,
 		NameStyle:   NameStyleReadable,
 		CardMap:     make(map[string]string),
+		CloudMap:    make(map[string]string),
 		HostnameMap: make(map[string]string),
 		IDMap:       make(map[string]string),
 		IntMap:      make(map[int]int),
 		IPMap:       make(map[string]string),
+		LabelMap:    make(map[string]string),
 		MACMap:      make(map[string]string),
 		NameMap:     make(map[string]string),
 		NumberMap:   make(map[string]float64),
+		PathMap:     make(map[string]string),
 		PhoneMap:    make(map[string]string),
 		ReplSetMap:  make(map[string]string),
 		SSNMap:      make(map[string]string),
@@ -120,16 +146,33 @@ func HashIndex(s string, max int) int {
 	if max <= 0 {
 		return 0
 	}
-	h := fnv.New32a()
-	h.Write([]byte(s))
-	return int(h.Sum32()) % max
+	return int(fnv32a(fnvOffset32, s)) % max
 }
 
 // HashOctet returns a deterministic octet (0-255) based on input and position
+// Same as FNV-1a of s + ":" + pos, without allocations
 func HashOctet(s string, pos int) int {
-	h := fnv.New32a()
-	h.Write([]byte(fmt.Sprintf("%s:%d", s, pos)))
-	return int(h.Sum32()) % 256
+	var buf [24]byte
+	h := fnv32a(fnvOffset32, s)
+	h = fnv32a(h, ":")
+	for _, c := range strconv.AppendInt(buf[:0], int64(pos), 10) {
+		h = (h ^ uint32(c)) * fnvPrime32
+	}
+	return int(h % 256)
+}
+
+// FNV-1a 32-bit parameters, see hash/fnv
+const (
+	fnvOffset32 = 2166136261
+	fnvPrime32  = 16777619
+)
+
+// fnv32a continues an FNV-1a 32-bit hash h over s
+func fnv32a(h uint32, s string) uint32 {
+	for i := 0; i < len(s); i++ {
+		h = (h ^ uint32(s[i])) * fnvPrime32
+	}
+	return h
 }
 
 // HashString returns a deterministic hex string based on input
@@ -143,80 +186,200 @@ func HashString(s string, length int) string {
 	return hex
 }
 
+// keyedHash returns HMAC-SHA256 of s keyed by SecretKey
+func (o *Obfuscator) keyedHash(s string) []byte {
+	mac := hmac.New(sha256.New, []byte(o.SecretKey))
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
 // --- PII Detection Functions ---
 
 // ContainsIP checks if string contains an IP address
 func ContainsIP(s string) bool {
-	return ReIP.MatchString(s)
+	start, _ := indexIP(s)
+	return start >= 0
 }
 
 // ContainsEmail checks if string contains an email address
 func ContainsEmail(s string) bool {
-	return ReEmail.MatchString(s)
+	return strings.IndexByte(s, '@') >= 0 && ReEmail.MatchString(s)
 }
 
 // ContainsFQDN checks if string contains a fully qualified domain name
+// A label character, a dot and two letters always match ReFQDN
 func ContainsFQDN(s string) bool {
-	return ReFQDN.MatchString(s)
+	return hasShape(s, "w.aa")
 }
 
 // ContainsSSN checks if string contains a Social Security Number
+// The shape is the same as ReSSN, without running the regex
 func ContainsSSN(s string) bool {
-	return ReSSN.MatchString(s)
+	return hasShape(s, ssnShape)
 }
 
 // ContainsMAC checks if string contains a MAC address
+// The shape is the same as ReMAC, without running the regex
 func ContainsMAC(s string) bool {
-	return ReMAC.MatchString(s)
+	return hasShape(s, macShape)
 }
 
 // ContainsPhoneNo checks if string contains a phone number
 func ContainsPhoneNo(s string) bool {
-	if !RePhone.MatchString(s) {
+	// Count digits first - phone numbers have 10-15 digits
+	digits := countDigits(s)
+	return digits >= 10 && digits <= 15 && RePhone.MatchString(s)
+}
+
+// ContainsCreditCardNo checks if string contains a credit card number
+func ContainsCreditCardNo(s string) bool {
+	// Basic Luhn check could be added here
+	digits := countDigits(s)
+	return digits >= 13 && digits <= 19 && ReCard.MatchString(s)
+}
+
+// IsNamespace checks if string looks like a MongoDB namespace (db.collection)
+func IsNamespace(s string) bool {
+	if strings.ContainsAny(s, "/\\") {
+		return false
+	}
+	dots := strings.Count(s, ".")
+	if dots < 1 || dots > 2 {
 		return false
 	}
-	// Count digits - phone numbers have 10-15 digits
+	// No empty parts
+	return s[0] != '.' && s[len(s)-1] != '.' && !strings.Contains(s, "..")
+}
+
+// countDigits returns the number of ASCII digits in s
+func countDigits(s string) int {
 	digits := 0
-	for _, c := range s {
-		if c >= '0' && c <= '9' {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
 			digits++
 		}
 	}
-	return digits >= 10 && digits <= 15
+	return digits
 }
 
-// ContainsCreditCardNo checks if string contains a credit card number
-func ContainsCreditCardNo(s string) bool {
-	if !ReCard.MatchString(s) {
-		return false
+// Shapes of fixed length patterns, see hasShape
+const (
+	dateShape = "dddd-dd-dd"
+	macShape  = "hhshhshhshhshhshh"
+	ssnShape  = "ddd-dd-dddd"
+	uuidShape = "hhhhhhhh-hhhh-hhhh-hhhh-hhhhhhhhhhhh"
+)
+
+// indexIP returns the bounds of the first match of ReIP in s, or -1, -1, without running the regex
+func indexIP(s string) (int, int) {
+	for i := 0; i < len(s); i++ {
+		if end := matchOctets(s, i, 4); end >= 0 {
+			return i, end
+		}
 	}
-	// Basic Luhn check could be added here
+	return -1, -1
+}
+
+// matchOctets returns the end of n dot separated groups of 1 to 3 digits at s[i:], or -1
+// Longer groups are tried first, as ReIP does
+func matchOctets(s string, i int, n int) int {
 	digits := 0
-	for _, c := range s {
-		if c >= '0' && c <= '9' {
-			digits++
+	for digits < 3 && i+digits < len(s) && s[i+digits] >= '0' && s[i+digits] <= '9' {
+		digits++
+	}
+	for ; digits > 0; digits-- {
+		j := i + digits
+		if n == 1 {
+			return j
+		}
+		if j < len(s) && s[j] == '.' {
+			if end := matchOctets(s, j+1, n-1); end >= 0 {
+				return end
+			}
 		}
 	}
-	return digits >= 13 && digits <= 19
+	return -1
 }
 
-// IsNamespace checks if string looks like a MongoDB namespace (db.collection)
-func IsNamespace(s string) bool {
-	if strings.Contains(s, "/") || strings.Contains(s, "\\") {
-		return false
+// hasShape is a fast pre-filter checking if s contains shape, where d is a digit, h a hex digit,
+// a a letter, w a hostname label character, s a : or - separator, and other characters match themselves
+func hasShape(s string, shape string) bool {
+	return shapeIndex(s, shape) >= 0
+}
+
+// shapeIndex returns the index of the first occurrence of shape in s, or -1
+// Candidates are found by the first literal or separator of the shape, such as the - of a date
+func shapeIndex(s string, shape string) int {
+	k := strings.IndexFunc(shape, func(r rune) bool { return !strings.ContainsRune("dhaw", r) })
+	if k < 0 {
+		for i := 0; i+len(shape) <= len(s); i++ {
+			if matchesShapeAt(s[i:], shape) {
+				return i
+			}
+		}
+		return -1
 	}
-	parts := strings.Split(s, ".")
-	if len(parts) < 2 || len(parts) > 3 {
-		return false
+	anchor := shape[k : k+1]
+	if anchor == "s" {
+		anchor = ":-"
 	}
-	for _, part := range parts {
-		if len(part) == 0 {
+	for from := k; from < len(s); {
+		p := strings.IndexAny(s[from:], anchor)
+		if p < 0 {
+			return -1
+		}
+		i := from + p - k
+		if i+len(shape) > len(s) {
+			return -1
+		}
+		if matchesShapeAt(s[i:], shape) {
+			return i
+		}
+		from += p + 1
+	}
+	return -1
+}
+
+// matchesShapeAt checks if s starts with shape
+func matchesShapeAt(s string, shape string) bool {
+	for j := 0; j < len(shape); j++ {
+		if !matchesShape(s[j], shape[j]) {
 			return false
 		}
 	}
 	return true
 }
 
+// matchesShape checks a byte against a hasShape class
+func matchesShape(c byte, class byte) bool {
+	switch class {
+	case 'd':
+		return c >= '0' && c <= '9'
+	case 'h':
+		return (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'f')
+	case 'a':
+		return c|0x20 >= 'a' && c|0x20 <= 'z'
+	case 'w':
+		return c == '-' || (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'z')
+	case 's':
+		return c == ':' || c == '-'
+	}
+	return c == class
+}
+
+// findFQDN returns the leftmost ReFQDN match
+// The regex runs from the start of the first label.tld candidate, no match can start earlier
+func findFQDN(s string) string {
+	i := shapeIndex(s, "w.aa")
+	if i < 0 {
+		return ""
+	}
+	for i > 0 && (s[i-1] == '.' || matchesShape(s[i-1], 'w')) {
+		i--
+	}
+	return ReFQDN.FindString(s[i:])
+}
+
 // LooksLikeHostname checks if string looks like a hostname
 func LooksLikeHostname(s string) bool {
 	if strings.Contains(s, " ") {
@@ -233,24 +396,19 @@ func LooksLikeHostname(s string) bool {
 
 // LooksLikeHostPort checks if string matches hostname:port pattern
 func LooksLikeHostPort(s string) bool {
-	matched, _ := regexp.MatchString(`^[a-zA-Z0-9._-]+:\d+$`, s)
-	return matched
+	return reHostPort.MatchString(s)
 }
 
 // --- Core Obfuscation Methods ---
 
 // ObfuscateIP obfuscates an IP address consistently
 func (o *Obfuscator) ObfuscateIP(ip string) string {
-	if !ContainsIP(ip) {
-		return ip
-	}
-
-	matches := ReIP.FindStringSubmatch(ip)
-	if len(matches) == 0 {
+	start, end := indexIP(ip)
+	if start < 0 {
 		return ip
 	}
 
-	matched := matches[0]
+	matched := ip[start:end]
 	if matched == "0.0.0.0" || matched == "127.0.0.1" {
 		return ip
 	}
@@ -263,6 +421,7 @@ func (o *Obfuscator) ObfuscateIP(ip string) string {
 	}
 
 	if cached, exists := o.IPMap[baseIP]; exists {
+		o.audit("ip", baseIP, cached)
 		return strings.Replace(ip, matched, cached, -1) + cidrSuffix
 	}
 
@@ -274,16 +433,17 @@ func (o *Obfuscator) ObfuscateIP(ip string) string {
 
 	switch o.IPStyle {
 	case IPStylePrivate:
-		hash := sha256.Sum256([]byte(baseIP))
+		hash := o.hashBytes("ip_private", baseIP, 3)
 		newIP = fmt.Sprintf("10.%d.%d.%d", hash[0], hash[1], hash[2])
 	case IPStyleKeepEnds:
 		fallthrough
 	default:
-		newIP = octets[0] + "." + strconv.Itoa(HashOctet(baseIP, 1)) + "." +
-			strconv.Itoa(HashOctet(baseIP, 2)) + "." + octets[3]
+		newIP = octets[0] + "." + strconv.Itoa(o.hashIndex("ip", baseIP, 1, 256)) + "." +
+			strconv.Itoa(o.hashIndex("ip", baseIP, 2, 256)) + "." + octets[3]
 	}
 
 	o.IPMap[baseIP] = newIP
+	o.audit("ip", baseIP, newIP)
 	return strings.Replace(ip, matched, newIP, -1) + cidrSuffix
 }
 
@@ -294,41 +454,56 @@ func (o *Obfuscator) ObfuscateHostname(hostname string) string {
 	}
 
 	if cached, exists := o.HostnameMap[hostname]; exists {
+		o.audit("hostname", hostname, cached)
 		return cached
 	}
 
 	var obfuscated string
 	switch o.NameStyle {
 	case NameStyleHash:
-		hash := HashString(hostname, 8)
+		hash := o.hashHex("hostname", hostname, 8)
 		obfuscated = fmt.Sprintf("host-%s.local", hash)
+	case NameStyleLabel:
+		obfuscated = o.ObfuscateLabels(hostname)
 	case NameStyleReadable:
 		fallthrough
 	default:
-		city := Cities[HashIndex(hostname, len(Cities))]
-		flower := Flowers[HashIndex(hostname+"flower", len(Flowers))]
+		city := o.pickCity(hostname)
+		flower := o.pickFlower(hostname)
 		obfuscated = strings.ToLower(flower + "." + city + ".local")
 	}
 
 	o.HostnameMap[hostname] = obfuscated
+	o.audit("hostname", hostname, obfuscated)
 	return obfuscated
 }
 
 // ObfuscateHostPort obfuscates hostname:port strings
+// The host is mapped as in text, so that it gets the same pseudonym everywhere
 func (o *Obfuscator) ObfuscateHostPort(value string) string {
 	parts := strings.Split(value, ":")
-	if len(parts) != 2 {
+	if len(parts) == 1 {
+		return o.obfuscateHost(value)
+	} else if len(parts) != 2 {
 		return o.ObfuscateHostname(value)
 	}
 
 	host := parts[0]
 	port := parts[1]
 
-	if ContainsIP(host) {
-		return o.ObfuscateIP(host) + ":" + port
-	}
+	return o.obfuscateHost(host) + ":" + port
+}
 
-	return o.ObfuscateHostname(host) + ":" + port
+// obfuscateHost obfuscates a host of a seed list, connection string or bindIp the same way as in text, an IP with
+// ObfuscateIP, an FQDN with ObfuscateFQDN and a short name with ObfuscateHostname
+func (o *Obfuscator) obfuscateHost(host string) string {
+	switch {
+	case ContainsIP(host):
+		return o.ObfuscateIP(host)
+	case findFQDN(host) == host:
+		return o.ObfuscateFQDN(host)
+	}
+	return o.ObfuscateHostname(host)
 }
 
 // ObfuscateReplSet obfuscates a replica set name consistently
@@ -338,22 +513,26 @@ func (o *Obfuscator) ObfuscateReplSet(name string) string {
 	}
 
 	if cached, exists := o.ReplSetMap[name]; exists {
+		o.audit("replset", name, cached)
 		return cached
 	}
 
 	var obfuscated string
 	switch o.NameStyle {
 	case NameStyleHash:
-		hash := HashString(name, 8)
+		hash := o.hashHex("replset", name, 8)
 		obfuscated = fmt.Sprintf("rs-%s", hash)
 	case NameStyleReadable:
 		fallthrough
 	default:
-		city := Cities[HashIndex(name, len(Cities))]
+		city := o.pickCity(name)
 		obfuscated = strings.ToLower("rs-" + city)
 	}
 
+	// set names come from free text too, two sets must not merge
+	obfuscated = o.uniqueName("replset", o.ReplSetMap, obfuscated)
 	o.ReplSetMap[name] = obfuscated
+	o.audit("replset", name, obfuscated)
 	return obfuscated
 }
 
@@ -370,14 +549,16 @@ func (o *Obfuscator) ObfuscateEmail(email string) string {
 
 	matched := matches[0]
 	if cached, exists := o.NameMap[matched]; exists {
+		o.audit("email", matched, cached)
 		return strings.Replace(email, matched, cached, -1)
 	}
 
-	city := Cities[HashIndex(matched, len(Cities))]
-	flower := Flowers[HashIndex(matched+"flower", len(Flowers))]
+	city := o.pickCity(matched)
+	flower := o.pickFlower(matched)
 	newValue := strings.ToLower(flower + "@" + city + ".com")
 
 	o.NameMap[matched] = newValue
+	o.audit("email", matched, newValue)
 	o.NameMap[newValue] = newValue // Prevent re-obfuscation
 	return strings.Replace(email, matched, newValue, -1)
 }
@@ -387,22 +568,21 @@ func (o *Obfuscator) ObfuscateFQDN(fqdn string) string {
 	if strings.Contains(fqdn, "/") || strings.Contains(fqdn, "\\") {
 		return fqdn
 	}
-	if !ContainsFQDN(fqdn) {
+	matched := findFQDN(fqdn)
+	if matched == "" {
 		return fqdn
 	}
-
-	matches := ReFQDN.FindStringSubmatch(fqdn)
-	if len(matches) == 0 {
-		return fqdn
-	}
-
-	matched := matches[0]
 	if cached, exists := o.NameMap[matched]; exists {
+		o.audit("fqdn", matched, cached)
 		return strings.Replace(fqdn, matched, cached, -1)
 	}
 
 	newValue := o.generateObfuscatedName(matched)
+	if o.NameStyle == NameStyleLabel {
+		newValue = o.ObfuscateLabels(matched)
+	}
 	o.NameMap[matched] = newValue
+	o.audit("fqdn", matched, newValue)
 	o.NameMap[newValue] = newValue
 	return strings.Replace(fqdn, matched, newValue, -1)
 }
@@ -416,40 +596,37 @@ func (o *Obfuscator) ObfuscateNamespace(ns string) string {
 		return ns
 	}
 
-	chars := ReDigit.ReplaceAllString(ns, "")
-	if len(chars) == 0 {
+	// Skip numbers, such as 1.5 or 10.0.0
+	if strings.Trim(ns, "0123456789.") == "" {
 		return ns
 	}
 
-	matches := ReNS.FindStringSubmatch(ns)
-	if len(matches) == 0 {
+	matched := ReNS.FindString(ns)
+	if matched == "" {
 		return ns
 	}
-
-	matched := matches[0]
 	if cached, exists := o.NameMap[matched]; exists {
+		o.audit("namespace", matched, cached)
 		return strings.Replace(ns, matched, cached, -1)
 	}
 
 	newValue := o.generateObfuscatedName(matched)
 	o.NameMap[matched] = newValue
+	o.audit("namespace", matched, newValue)
 	o.NameMap[newValue] = newValue
 	return strings.Replace(ns, matched, newValue, -1)
 }
 
 // ObfuscateSSN obfuscates a Social Security Number consistently
 func (o *Obfuscator) ObfuscateSSN(ssn string) string {
-	if !ContainsSSN(ssn) {
+	i := shapeIndex(ssn, ssnShape)
+	if i < 0 {
 		return ssn
 	}
 
-	matches := ReSSN.FindStringSubmatch(ssn)
-	if len(matches) == 0 {
-		return ssn
-	}
-
-	matched := matches[0]
+	matched := ssn[i : i+len(ssnShape)]
 	if cached, exists := o.SSNMap[matched]; exists {
+		o.audit("ssn", matched, cached)
 		return strings.Replace(ssn, matched, cached, -1)
 	}
 
@@ -462,24 +639,26 @@ func (o *Obfuscator) ObfuscateSSN(ssn string) string {
 
 	// Deterministic shuffle using hash
 	for i := len(digits) - 1; i > 0; i-- {
-		j := HashIndex(matched+strconv.Itoa(i), i+1)
+		j := o.hashIndex("ssn", matched, i, i+1)
 		digits[i], digits[j] = digits[j], digits[i]
 	}
 
 	newValue := string(digits[:3]) + "-" + string(digits[3:5]) + "-" + string(digits[5:])
 	o.SSNMap[matched] = newValue
+	o.audit("ssn", matched, newValue)
 	return strings.Replace(ssn, matched, newValue, -1)
 }
 
 // ObfuscateMAC obfuscates a MAC address consistently (keeps vendor prefix)
 func (o *Obfuscator) ObfuscateMAC(value string) string {
-	matches := ReMAC.FindStringSubmatch(value)
-	if len(matches) == 0 {
+	i := shapeIndex(value, macShape)
+	if i < 0 {
 		return value
 	}
 
-	matched := matches[0]
+	matched := value[i : i+len(macShape)]
 	if cached, exists := o.MACMap[matched]; exists {
+		o.audit("mac", matched, cached)
 		return strings.Replace(value, matched, cached, -1)
 	}
 
@@ -497,11 +676,12 @@ func (o *Obfuscator) ObfuscateMAC(value string) string {
 	newParts := make([]string, 6)
 	copy(newParts[:3], parts[:3])
 	for i := 3; i < 6; i++ {
-		newParts[i] = fmt.Sprintf("%02X", HashOctet(matched, i))
+		newParts[i] = fmt.Sprintf("%02X", o.hashIndex("mac", matched, i, 256))
 	}
 
 	newValue := strings.Join(newParts, sep)
 	o.MACMap[matched] = newValue
+	o.audit("mac", matched, newValue)
 	return strings.Replace(value, matched, newValue, -1)
 }
 
@@ -512,6 +692,7 @@ func (o *Obfuscator) ObfuscatePhoneNo(phoneNo string) string {
 	}
 
 	if cached, exists := o.PhoneMap[phoneNo]; exists {
+		o.audit("phone", phoneNo, cached)
 		return cached
 	}
 
@@ -521,7 +702,7 @@ func (o *Obfuscator) ObfuscatePhoneNo(phoneNo string) string {
 		if phoneNo[i] >= '0' && phoneNo[i] <= '9' {
 			n++
 			if n > 5 {
-				obfuscated[i] = byte(HashIndex(phoneNo+strconv.Itoa(i), 10) + '0')
+				obfuscated[i] = byte(o.hashIndex("phone", phoneNo, i, 10) + '0')
 			} else {
 				obfuscated[i] = phoneNo[i]
 			}
@@ -531,6 +712,7 @@ func (o *Obfuscator) ObfuscatePhoneNo(phoneNo string) string {
 	}
 
 	o.PhoneMap[phoneNo] = string(obfuscated)
+	o.audit("phone", phoneNo, string(obfuscated))
 	return string(obfuscated)
 }
 
@@ -541,6 +723,7 @@ func (o *Obfuscator) ObfuscateCreditCardNo(cardNo string) string {
 	}
 
 	if cached, exists := o.CardMap[cardNo]; exists {
+		o.audit("card", cardNo, cached)
 		return cached
 	}
 
@@ -556,43 +739,102 @@ func (o *Obfuscator) ObfuscateCreditCardNo(cardNo string) string {
 
 	result := string(obfuscated) + lastFourDigits
 	o.CardMap[cardNo] = result
+	o.audit("card", cardNo, result)
 	return result
 }
 
-// ObfuscateDate shifts dates by DateOffset days
+// ObfuscateDate shifts dates by DateOffset calendar days, so that whole weeks keep the weekday
+// Strings that are not valid dates, such as 2024-02-30, are shifted with approximate 28 to 30 day months
 func (o *Obfuscator) ObfuscateDate(value string) string {
-	matches := ReDate.FindAllString(value, -1)
-	if len(matches) == 0 {
+	i := shapeIndex(value, dateShape)
+	if i < 0 {
 		return value
 	}
 
-	for _, matched := range matches {
-		year, _ := strconv.Atoi(matched[0:4])
-		month, _ := strconv.Atoi(matched[5:7])
-		day, _ := strconv.Atoi(matched[8:10])
+	// Dates are spliced in place of each match, as found by ReDate
+	var b strings.Builder
+	b.Grow(len(value))
+	var date [16]byte
+	last := 0
+	for ; i >= 0; i = shapeIndex(value[last:], dateShape) {
+		i += last
+		matched := value[i : i+len(dateShape)]
+		b.WriteString(value[last:i])
+		last = i + len(dateShape)
+		var buf []byte
+		if t, err := time.Parse("2006-01-02", matched); err == nil {
+			buf = t.AddDate(0, 0, o.DateOffset).AppendFormat(date[:0], "2006-01-02")
+		} else {
+			buf = o.appendInvalidDate(date[:0], matched)
+		}
+		b.Write(buf)
+		if o.Audit != nil {
+			o.audit("date", matched, string(buf))
+		}
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
 
-		day += o.DateOffset
-		for day < 1 {
-			month--
-			if month < 1 {
-				month = 12
-				year--
-			}
-			day += 30
+// appendInvalidDate appends matched, which has the date shape but is not a valid date, shifted with
+// approximate 28 to 30 day months
+func (o *Obfuscator) appendInvalidDate(buf []byte, matched string) []byte {
+	year, _ := strconv.Atoi(matched[0:4])
+	month, _ := strconv.Atoi(matched[5:7])
+	day, _ := strconv.Atoi(matched[8:10])
+
+	day += o.DateOffset
+	for day < 1 {
+		month--
+		if month < 1 {
+			month = 12
+			year--
 		}
-		for day > 28 {
-			day -= 28
-			month++
-			if month > 12 {
-				month = 1
-				year++
-			}
+		day += 30
+	}
+	for day > 28 {
+		day -= 28
+		month++
+		if month > 12 {
+			month = 1
+			year++
 		}
+	}
+	return fmt.Appendf(buf, "%04d-%02d-%02d", year, month, day)
+}
 
-		newValue := fmt.Sprintf("%04d-%02d-%02d", year, month, day)
-		value = strings.Replace(value, matched, newValue, 1)
+// DeriveDateOffset sets DateOffset from SecretKey to a non-zero number of days within [minDays, maxDays]
+// With wholeWeeks the offset is a multiple of 7 days so that weekdays are preserved. It fails without
+// a SecretKey, which would give every customer the same offset, or without a candidate in the range
+func (o *Obfuscator) DeriveDateOffset(minDays int, maxDays int, wholeWeeks bool) (int, error) {
+	if o.SecretKey == "" {
+		return o.DateOffset, errors.New("date offset requires a SecretKey")
 	}
-	return value
+	if minDays > maxDays {
+		return o.DateOffset, fmt.Errorf("invalid date offset range [%d, %d]", minDays, maxDays)
+	}
+	unit := 1
+	if wholeWeeks {
+		unit = 7
+	}
+	lo := int(math.Ceil(float64(minDays) / float64(unit)))
+	hi := int(math.Floor(float64(maxDays) / float64(unit)))
+	count := hi - lo + 1
+	hasZero := lo <= 0 && hi >= 0
+	if hasZero {
+		count--
+	}
+	if count <= 0 {
+		return o.DateOffset, fmt.Errorf("no non-zero date offset in [%d, %d]", minDays, maxDays)
+	}
+
+	hash := o.keyedHash("date_offset")
+	n := lo + int(binary.BigEndian.Uint64(hash[:8])%uint64(count))
+	if hasZero && n >= 0 {
+		n++
+	}
+	o.DateOffset = n * unit
+	return o.DateOffset, nil
 }
 
 // ObfuscateInt obfuscates an integer using the coefficient
@@ -601,10 +843,12 @@ func (o *Obfuscator) ObfuscateInt(value int) int {
 		return value
 	}
 	if cached, exists := o.IntMap[value]; exists {
+		o.audit("int", strconv.Itoa(value), strconv.Itoa(cached))
 		return cached
 	}
 	newValue := int(float64(value) * o.Coefficient)
 	o.IntMap[value] = newValue
+	o.audit("int", strconv.Itoa(value), strconv.Itoa(newValue))
 	return newValue
 }
 
@@ -612,20 +856,77 @@ func (o *Obfuscator) ObfuscateInt(value int) int {
 func (o *Obfuscator) ObfuscateNumber(value float64) float64 {
 	key := fmt.Sprintf("%f", value)
 	if cached, exists := o.NumberMap[key]; exists {
+		o.audit("number", key, fmt.Sprintf("%f", cached))
 		return cached
 	}
 	newValue := value * o.Coefficient
 	o.NumberMap[key] = newValue
+	o.audit("number", key, fmt.Sprintf("%f", newValue))
 	return newValue
 }
 
+// obfuscateJSONNumber obfuscates a number decoded with UseNumber, keeping integers integral and exact
+func (o *Obfuscator) obfuscateJSONNumber(value json.Number) json.Number {
+	i, err := value.Int64()
+	if err != nil {
+		var f float64
+		if f, err = value.Float64(); err != nil {
+			return value
+		}
+		return json.Number(strconv.FormatFloat(o.ObfuscateNumber(f), 'f', -1, 64))
+	}
+	if i <= 1<<53 && i >= -1<<53 {
+		return json.Number(strconv.Itoa(o.ObfuscateInt(int(i))))
+	}
+	// beyond float64 precision
+	product := new(big.Float).SetPrec(128).SetInt64(i)
+	n, _ := product.Mul(product, big.NewFloat(o.Coefficient)).Int(nil)
+	return json.Number(n.String())
+}
+
 // --- Generic Traversal Methods ---
 
 // ObfuscateMap recursively obfuscates a map[string]interface{}
 func (o *Obfuscator) ObfuscateMap(doc map[string]interface{}) map[string]interface{} {
+	if result, ok := o.obfuscateExtJSON(doc); ok {
+		return result
+	}
+	// Keys are visited in order so that caches and audit records are reproducible
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
 	result := make(map[string]interface{}, len(doc))
-	for k, v := range doc {
-		result[k] = o.ObfuscateValue(v)
+	for _, k := range keys {
+		o.Audit.enter(k)
+		if name, ok := doc[k].(string); ok && isReplSetField(k, doc) {
+			result[k] = o.ObfuscateReplSet(name)
+		} else {
+			result[k] = o.ObfuscateValue(doc[k])
+		}
+		o.Audit.leave()
+	}
+	return result
+}
+
+// ObfuscateOrderedMap recursively obfuscates an OrderedMap, keeping its keys order
+func (o *Obfuscator) ObfuscateOrderedMap(om *OrderedMap) *OrderedMap {
+	if len(om.SortedKeys) > 0 && strings.HasPrefix(om.SortedKeys[0], "$") {
+		if result, ok := o.obfuscateExtJSON(om.plainMap()); ok {
+			return orderedLike(result, om)
+		}
+	}
+	result := &OrderedMap{SortedKeys: append([]string(nil), om.SortedKeys...), Map: make(map[string]interface{}, len(om.Map))}
+	for _, k := range om.SortedKeys {
+		o.Audit.enter(k)
+		if name, ok := om.Map[k].(string); ok && isReplSetField(k, om.Map) {
+			result.Map[k] = o.ObfuscateReplSet(name)
+		} else {
+			result.Map[k] = o.ObfuscateValue(om.Map[k])
+		}
+		o.Audit.leave()
 	}
 	return result
 }
@@ -634,7 +935,9 @@ func (o *Obfuscator) ObfuscateMap(doc map[string]interface{}) map[string]interfa
 func (o *Obfuscator) ObfuscateSlice(arr []interface{}) []interface{} {
 	result := make([]interface{}, len(arr))
 	for i, elem := range arr {
+		o.Audit.enterIndex(i)
 		result[i] = o.ObfuscateValue(elem)
+		o.Audit.leave()
 	}
 	return result
 }
@@ -644,8 +947,12 @@ func (o *Obfuscator) ObfuscateValue(value interface{}) interface{} {
 	switch v := value.(type) {
 	case map[string]interface{}:
 		return o.ObfuscateMap(v)
+	case *OrderedMap:
+		return o.ObfuscateOrderedMap(v)
 	case []interface{}:
 		return o.ObfuscateSlice(v)
+	case json.Number:
+		return o.obfuscateJSONNumber(v)
 	case string:
 		return o.ObfuscateString(v)
 	case int:
@@ -665,11 +972,25 @@ func (o *Obfuscator) ObfuscateValue(value interface{}) interface{} {
 
 // ObfuscateString applies all string obfuscation rules
 func (o *Obfuscator) ObfuscateString(value string) string {
+	// Every rule needs a digit, a separator or an @, such as in emails, hosts, paths and ObjectId(...)
+	if !strings.ContainsAny(value, "0123456789.@/:-=(") {
+		return value
+	}
+	// Cloud resources, ObjectIds, UUIDs, binary data and topology strings are kept away from the rules below
+	// The slice is reused across calls, and taken for this call in case a rule calls back in
+	shielded := o.shielded[:0]
+	o.shielded = nil
+	value = shieldNUL(value, &shielded)
+	value = o.shieldCloud(value, &shielded)
+	value = o.shieldIDs(value, &shielded)
+	value = o.shieldTopology(value, &shielded)
+
 	// Port numbers
-	if matches := RePort.FindStringSubmatch(value); len(matches) > 0 {
-		matched := matches[0]
+	if start, end := indexPort(value); start >= 0 {
+		matched := value[start:end]
 		port := ToInt(matched[1:])
-		newValue := fmt.Sprintf(":%v", int(float64(port)*o.Coefficient))
+		newValue := ":" + strconv.Itoa(int(float64(port)*o.Coefficient))
+		o.audit("port", matched, newValue)
 		value = strings.Replace(value, matched, newValue, -1)
 	}
 
@@ -688,15 +1009,68 @@ func (o *Obfuscator) ObfuscateString(value string) string {
 	value = o.ObfuscatePhoneNo(value)
 	value = o.ObfuscateDate(value)
 
+	value = unshield(value, shielded)
+	clear(shielded)
+	o.shielded = shielded[:0]
 	return value
 }
 
+// ObfuscateBytes appends the obfuscated src to dst and returns the extended buffer
+// Lines without candidate characters are copied without conversion
+func (o *Obfuscator) ObfuscateBytes(dst []byte, src []byte) []byte {
+	if !bytes.ContainsAny(src, "0123456789.@/:-=(") {
+		return append(dst, src...)
+	}
+	return append(dst, o.ObfuscateString(string(src))...)
+}
+
+// indexPort returns the bounds of the first match of RePort in s, or -1, -1, without running the regex
+func indexPort(s string) (int, int) {
+	for i := strings.IndexByte(s, ':'); i >= 0; {
+		end := i + 1
+		for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+			end++
+		}
+		if end-i > 2 {
+			return i, end
+		}
+		j := strings.IndexByte(s[i+1:], ':')
+		if j < 0 {
+			break
+		}
+		i += 1 + j
+	}
+	return -1, -1
+}
+
 // --- Utility Methods ---
 
+// uniqueName returns name, or name with the first free counter from 2 if another input of the cache already maps
+// to it, so that different inputs never share a pseudonym
+func (o *Obfuscator) uniqueName(kind string, cache map[string]string, name string) string {
+	if o.taken == nil {
+		o.taken = make(map[string]map[string]bool)
+	}
+	taken, ok := o.taken[kind]
+	if !ok {
+		taken = make(map[string]bool, len(cache))
+		for _, v := range cache {
+			taken[v] = true
+		}
+		o.taken[kind] = taken
+	}
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = name + "-" + strconv.Itoa(i)
+	}
+	taken[unique] = true
+	return unique
+}
+
 // generateObfuscatedName generates an obfuscated name from city and flower
 func (o *Obfuscator) generateObfuscatedName(matched string) string {
-	city := Cities[HashIndex(matched, len(Cities))]
-	flower := Flowers[HashIndex(matched+"flower", len(Flowers))]
+	city := o.pickCity(matched)
+	flower := o.pickFlower(matched)
 	parts := strings.Split(matched, ".")
 	if len(parts) > 2 {
 		tail := parts[len(parts)-1]
@@ -719,29 +1093,94 @@ func (o *Obfuscator) GetMappings() map[string]interface{} {
 		"coefficient":  o.Coefficient,
 		"date_offset":  o.DateOffset,
 		"card_map":     o.CardMap,
+		"cloud_map":    o.CloudMap,
 		"hostname_map": o.HostnameMap,
 		"id_map":       o.IDMap,
 		"ip_map":       o.IPMap,
+		"label_map":    o.LabelMap,
 		"mac_map":      o.MACMap,
 		"name_map":     filteredNameMap,
+		"path_map":     o.PathMap,
 		"phone_map":    o.PhoneMap,
 		"replset_map":  o.ReplSetMap,
 		"ssn_map":      o.SSNMap,
 	}
 }
 
+// SaveMappings writes all obfuscation mappings, including the date offset, to a JSON file
+func (o *Obfuscator) SaveMappings(filename string) error {
+	data, err := json.MarshalIndent(o.GetMappings(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
+
+// LoadMappings restores mappings written by SaveMappings so that later runs line up
+func (o *Obfuscator) LoadMappings(filename string) error {
+	var err error
+	var data []byte
+	var saved struct {
+		Coefficient *float64          `json:"coefficient"`
+		DateOffset  *int              `json:"date_offset"`
+		CardMap     map[string]string `json:"card_map"`
+		CloudMap    map[string]string `json:"cloud_map"`
+		HostnameMap map[string]string `json:"hostname_map"`
+		IDMap       map[string]string `json:"id_map"`
+		IPMap       map[string]string `json:"ip_map"`
+		LabelMap    map[string]string `json:"label_map"`
+		MACMap      map[string]string `json:"mac_map"`
+		NameMap     map[string]string `json:"name_map"`
+		PathMap     map[string]string `json:"path_map"`
+		PhoneMap    map[string]string `json:"phone_map"`
+		ReplSetMap  map[string]string `json:"replset_map"`
+		SSNMap      map[string]string `json:"ssn_map"`
+	}
+
+	if data, err = os.ReadFile(filename); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	if saved.Coefficient != nil {
+		o.Coefficient = *saved.Coefficient
+	}
+	if saved.DateOffset != nil {
+		o.DateOffset = *saved.DateOffset
+	}
+	for _, m := range []struct{ from, to map[string]string }{
+		{saved.CardMap, o.CardMap}, {saved.CloudMap, o.CloudMap}, {saved.HostnameMap, o.HostnameMap}, {saved.IDMap, o.IDMap},
+		{saved.IPMap, o.IPMap}, {saved.LabelMap, o.LabelMap}, {saved.MACMap, o.MACMap}, {saved.PathMap, o.PathMap}, {saved.PhoneMap, o.PhoneMap},
+		{saved.ReplSetMap, o.ReplSetMap}, {saved.SSNMap, o.SSNMap},
+	} {
+		for k, v := range m.from {
+			m.to[k] = v
+		}
+	}
+	for k, v := range saved.NameMap {
+		o.NameMap[k] = v
+		o.NameMap[v] = v // Prevent re-obfuscation
+	}
+	o.taken = nil
+	return nil
+}
+
 // Reset clears all obfuscation mappings
 func (o *Obfuscator) Reset() {
 	o.CardMap = make(map[string]string)
+	o.CloudMap = make(map[string]string)
 	o.HostnameMap = make(map[string]string)
 	o.IDMap = make(map[string]string)
 	o.IntMap = make(map[int]int)
 	o.IPMap = make(map[string]string)
+	o.LabelMap = make(map[string]string)
 	o.MACMap = make(map[string]string)
 	o.NameMap = make(map[string]string)
 	o.NumberMap = make(map[string]float64)
+	o.PathMap = make(map[string]string)
 	o.PhoneMap = make(map[string]string)
 	o.ReplSetMap = make(map[string]string)
 	o.SSNMap = make(map[string]string)
+	o.taken = nil
 }
-
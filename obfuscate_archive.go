@@ -0,0 +1,499 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_archive.go
+
+package gox
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// BinaryPolicy defines what to do with archive members that cannot be obfuscated
+type BinaryPolicy int
+
+const (
+	// BinaryCopy copies binary members, such as diagnostic.data, unchanged
+	BinaryCopy BinaryPolicy = iota
+	// BinarySkip leaves binary members out of the new archive
+	BinarySkip
+)
+
+// ArchiveOptions defines how a diagnostic archive is obfuscated
+type ArchiveOptions struct {
+	BinaryPolicy BinaryPolicy // What to do with binary members
+	CSV          CSVOptions   // Rules for CSV and TSV members
+}
+
+// archive member content types
+const (
+	memberBinary = iota
+	memberCSV
+	memberJSONLines
+	memberJSON
+	memberText
+)
+
+// archiveMember describes a member read from an archive
+type archiveMember struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	isDir   bool
+}
+
+// archiveWriter adds members to a zip or tar archive
+type archiveWriter interface {
+	add(member archiveMember, filename string) error
+	Close() error
+}
+
+// ObfuscateArchive obfuscates a zip, tar or tar.gz archive member by member into outfile
+// The output format follows the outfile extension, or the input format if not recognized, and outfile is only
+// created if all members are obfuscated
+func (o *Obfuscator) ObfuscateArchive(infile string, outfile string, opts ArchiveOptions) error {
+	var err error
+	var format, stage string
+	var out *FileWriter
+	var writer archiveWriter
+
+	if format, err = archiveFormat(infile); err != nil {
+		return err
+	}
+	lower := strings.ToLower(outfile)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		format = "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		format = "tar.gz"
+	case strings.HasSuffix(lower, ".tar"):
+		format = "tar"
+	}
+
+	// Members are obfuscated into a staging directory one at a time and added from there
+	if stage, err = os.MkdirTemp("", "gox-archive-"); err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+	if out, err = NewFileWriter(outfile, FileWriterOptions{Compression: CompressionNone}); err != nil {
+		return err
+	}
+	if format == "zip" {
+		writer = &zipArchiveWriter{writer: zip.NewWriter(out), stage: stage}
+	} else {
+		writer = newTarArchiveWriter(out, format == "tar.gz")
+	}
+
+	err = walkArchive(infile, func(member archiveMember, reader io.Reader) error {
+		// records carry the obfuscated member name, the original may contain a hostname
+		o.Audit.setFile("")
+		member.name = o.obfuscateMemberName(member.name)
+		o.Audit.setFile(member.name)
+		if member.isDir {
+			return writer.add(member, "")
+		}
+		return o.obfuscateMember(member, reader, writer, stage, opts)
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Close()
+}
+
+// obfuscateMember obfuscates one member by content type into the staging directory and adds it to the archive
+func (o *Obfuscator) obfuscateMember(member archiveMember, reader io.Reader, writer archiveWriter, stage string,
+	opts ArchiveOptions) error {
+	var err error
+	var target string
+	var staged *os.File
+	var dreader *Reader
+
+	// Compressed members are obfuscated decompressed and compressed again the same way
+	br := bufio.NewReader(reader)
+	magic, _ := br.Peek(10)
+	undecodable := IsXz(magic) || IsLz4(magic)
+	rawSnappy := hasSnappyExt(member.name) && !IsCompressed(magic)
+	if undecodable {
+		dreader = &Reader{Reader: br}
+	} else if dreader, err = newReader(br, rawSnappy); err != nil {
+		return err
+	}
+	defer dreader.Close()
+	if IsBzip2(magic) {
+		// bzip2 cannot be written again, the member is stored decompressed
+		member.name = strings.TrimSuffix(member.name, ".bz2")
+	} else if rawSnappy {
+		// neither can a raw snappy block, which is not streamed
+		member.name = strings.TrimSuffix(member.name, filepath.Ext(member.name))
+	}
+	kind := detectMemberType(member.name, dreader.Reader)
+	if undecodable {
+		kind = memberBinary
+	}
+	if kind == memberBinary && opts.BinaryPolicy == BinarySkip {
+		return nil
+	}
+
+	if target, err = extractPath(stage, member.name); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if staged, err = os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); err != nil {
+		return err
+	}
+	defer os.Remove(target)
+	defer staged.Close()
+
+	var w io.WriteCloser = nopWriteCloser{staged}
+	if IsGzip(magic) {
+		w = gzip.NewWriter(staged)
+	} else if IsSnappy(magic) {
+		w = snappy.NewBufferedWriter(staged)
+	} else if IsZstd(magic) {
+		if w, err = zstd.NewWriter(staged); err != nil {
+			return err
+		}
+	}
+	switch kind {
+	case memberCSV:
+		err = o.ObfuscateCSV(dreader, w, opts.CSV)
+	case memberJSONLines:
+		err = o.obfuscateJSONLines(dreader.Reader, w)
+	case memberJSON:
+		err = o.obfuscateJSONDocument(dreader.Reader, w)
+	case memberText:
+		err = o.ObfuscateText(dreader, w)
+	default:
+		_, err = io.Copy(w, dreader)
+	}
+	if err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = staged.Close(); err != nil {
+		return err
+	}
+	return writer.add(member, target)
+}
+
+// obfuscateJSONLines obfuscates one JSON document per line, such as mongod 4.4+ logs
+func (o *Obfuscator) obfuscateJSONLines(reader *bufio.Reader, writer io.Writer) error {
+	bw := bufio.NewWriter(writer)
+	var offset int64
+	for n := 1; ; n++ {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			o.Audit.setLine(n, offset)
+			offset += int64(len(line))
+			text := strings.TrimRight(line, "\r\n")
+			if doc, err := decodeOrderedJSON([]byte(text)); err == nil {
+				b, _ := marshalJSON(o.ObfuscateValue(doc), false)
+				bw.Write(b)
+			} else {
+				bw.WriteString(o.ObfuscateString(text))
+			}
+			bw.WriteString(line[len(text):])
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// obfuscateJSONDocument obfuscates a single JSON document, such as getMongoData output
+func (o *Obfuscator) obfuscateJSONDocument(reader *bufio.Reader, writer io.Writer) error {
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	doc, err := decodeOrderedJSON(b)
+	if err != nil {
+		// Not valid JSON after all, fall back to text rules
+		return o.ObfuscateText(bytes.NewReader(b), writer)
+	}
+	if b, err = marshalJSON(o.ObfuscateValue(doc), bytes.Contains(b, []byte{'\n'})); err != nil {
+		return err
+	}
+	_, err = writer.Write(b)
+	return err
+}
+
+// obfuscateMemberName obfuscates hostnames and IPs embedded in archive member paths
+func (o *Obfuscator) obfuscateMemberName(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		// IPs first, their octets would be taken for numeric rotation suffixes below
+		segment = ReIP.ReplaceAllStringFunc(segment, o.ObfuscateIP)
+		stem := segment
+		for {
+			ext := filepath.Ext(stem)
+			if ext == "" || ext == stem || !isFileExtension(ext) {
+				break
+			}
+			stem = stem[:len(stem)-len(ext)]
+		}
+		newStem := ReFQDN.ReplaceAllStringFunc(stem, func(matched string) string {
+			if strings.Count(matched, ".") < 2 {
+				return matched
+			}
+			return o.ObfuscateFQDN(matched)
+		})
+		segments[i] = newStem + segment[len(stem):]
+	}
+	return strings.Join(segments, "/")
+}
+
+// isFileExtension checks if ext is a file type or rotation suffix rather than a domain label
+func isFileExtension(ext string) bool {
+	ext = strings.ToLower(ext[1:])
+	if ext != "" && ext[0] >= '0' && ext[0] <= '9' {
+		return true
+	}
+	switch ext {
+	case "log", "json", "txt", "csv", "tsv", "gz", "tgz", "zst", "sz", "snappy", "bz2", "xz", "lz4", "bson",
+		"conf", "cfg", "yaml", "yml", "tar", "zip", "out", "err", "ftdc", "interim":
+		return true
+	}
+	return false
+}
+
+// detectMemberType detects member content from its name and first decompressed bytes
+func detectMemberType(name string, reader *bufio.Reader) int {
+	buf, _ := reader.Peek(8 * 1024)
+	if bytes.IndexByte(buf, 0) >= 0 || !utf8.Valid(trimPartialRune(buf)) {
+		return memberBinary
+	}
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".gz", ".sz", ".snappy"} {
+		lower = strings.TrimSuffix(lower, ext)
+	}
+	if strings.HasSuffix(lower, ".csv") || strings.HasSuffix(lower, ".tsv") {
+		return memberCSV
+	}
+	trimmed := bytes.TrimLeft(buf, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		if i := bytes.IndexByte(trimmed, '\n'); i > 0 && json.Valid(trimmed[:i]) {
+			return memberJSONLines
+		}
+		return memberJSON
+	} else if len(trimmed) > 0 && trimmed[0] == '[' {
+		return memberJSON
+	}
+	return memberText
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence cut off at the end of buf
+func trimPartialRune(buf []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(buf); i++ {
+		if utf8.RuneStart(buf[len(buf)-i]) {
+			if !utf8.FullRune(buf[len(buf)-i:]) {
+				return buf[:len(buf)-i]
+			}
+			break
+		}
+	}
+	return buf
+}
+
+// marshalJSON marshals a value decoded by decodeOrderedJSON without HTML escaping, optionally indented
+func marshalJSON(v interface{}, indent bool) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeOrderedJSON(&buf, v); err != nil {
+		return nil, err
+	}
+	if !indent {
+		return buf.Bytes(), nil
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	indented.WriteByte('\n')
+	return indented.Bytes(), nil
+}
+
+// archiveFormat detects zip, tar.gz or tar from magic bytes
+func archiveFormat(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(file, buf)
+	buf = buf[:n]
+	switch {
+	case IsZip(buf):
+		return "zip", nil
+	case IsGzip(buf):
+		return "tar.gz", nil
+	case len(buf) >= 262 && string(buf[257:262]) == "ustar":
+		return "tar", nil
+	}
+	return "", errors.New("unsupported archive format: " + filename)
+}
+
+// walkArchive calls fn for each member of a zip, tar or tar.gz archive
+func walkArchive(filename string, fn func(member archiveMember, reader io.Reader) error) error {
+	format, err := archiveFormat(filename)
+	if err != nil {
+		return err
+	}
+
+	if format == "zip" {
+		var zreader *zip.ReadCloser
+		if zreader, err = zip.OpenReader(filename); err != nil {
+			return err
+		}
+		defer zreader.Close()
+		for _, f := range zreader.File {
+			member := archiveMember{name: f.Name, mode: f.Mode(), modTime: f.Modified, isDir: f.FileInfo().IsDir()}
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err != nil {
+				return err
+			}
+			err = fn(member, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var reader *Reader
+	if reader, err = NewFileReader(filename); err != nil {
+		return err
+	}
+	defer reader.Close()
+	treader := tar.NewReader(reader)
+	for {
+		var header *tar.Header
+		if header, err = treader.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+		member := archiveMember{name: header.Name, mode: header.FileInfo().Mode(), modTime: header.ModTime,
+			isDir: header.Typeflag == tar.TypeDir}
+		if err = fn(member, treader); err != nil {
+			return err
+		}
+	}
+}
+
+// zipArchiveWriter writes members staged as files into a zip archive, the way ZipFiles does
+type zipArchiveWriter struct {
+	writer *zip.Writer
+	stage  string
+}
+
+func (zw *zipArchiveWriter) add(member archiveMember, filename string) error {
+	if member.isDir {
+		header := &zip.FileHeader{Name: strings.TrimSuffix(member.name, "/") + "/", Method: zip.Store,
+			Modified: member.modTime}
+		header.SetMode(member.mode)
+		_, err := zw.writer.CreateHeader(header)
+		return err
+	}
+	// the staged file carries the member permissions and time into its zip header
+	if err := os.Chmod(filename, member.mode.Perm()|0400); err != nil {
+		return err
+	}
+	if !member.modTime.IsZero() {
+		if err := os.Chtimes(filename, time.Now(), member.modTime); err != nil {
+			return err
+		}
+	}
+	return addZipFile(zw.writer, filename, ZipOptions{BaseDir: zw.stage, Method: ZipMethod})
+}
+
+func (zw *zipArchiveWriter) Close() error {
+	return zw.writer.Close()
+}
+
+// tarArchiveWriter writes members into a tar or tar.gz archive
+type tarArchiveWriter struct {
+	gzipWriter *gzip.Writer
+	writer     *tar.Writer
+}
+
+func newTarArchiveWriter(w io.Writer, compressed bool) *tarArchiveWriter {
+	tw := &tarArchiveWriter{}
+	if compressed {
+		tw.gzipWriter = gzip.NewWriter(w)
+		w = tw.gzipWriter
+	}
+	tw.writer = tar.NewWriter(w)
+	return tw
+}
+
+func (tw *tarArchiveWriter) add(member archiveMember, filename string) error {
+	header := &tar.Header{Name: member.name, Mode: int64(member.mode.Perm()), ModTime: member.modTime,
+		Typeflag: tar.TypeReg}
+	if member.isDir {
+		header.Name = strings.TrimSuffix(member.name, "/") + "/"
+		header.Typeflag = tar.TypeDir
+		return tw.writer.WriteHeader(header)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header.Size = info.Size()
+	if err = tw.writer.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw.writer, file)
+	return err
+}
+
+func (tw *tarArchiveWriter) Close() error {
+	if err := tw.writer.Close(); err != nil {
+		return err
+	}
+	if tw.gzipWriter != nil {
+		return tw.gzipWriter.Close()
+	}
+	return nil
+}
+
+// nopWriteCloser adds a no-op Close to an io.Writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
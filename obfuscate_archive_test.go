@@ -0,0 +1,297 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_archive_test.go
+
+package gox
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+func createTestArchive(t *testing.T, filename string) {
+	var gzbuf bytes.Buffer
+	gz := gzip.NewWriter(&gzbuf)
+	gz.Write([]byte(`{"t":{"$date":"2024-06-15T10:00:00.000Z"},"attr":{"remote":"192.168.1.100:51234"}}` + "\n"))
+	gz.Close()
+	var zstbuf bytes.Buffer
+	zw, _ := zstd.NewWriter(&zstbuf)
+	zw.Write([]byte("2024-06-15T10:00:00 connection accepted from 192.168.1.100:51234\n"))
+	zw.Close()
+
+	members := []struct {
+		name string
+		data []byte
+	}{
+		{"logs/mongod-db1.prod.acme.com.log", []byte("2024-06-15T10:00:00 connection accepted from 192.168.1.100:51234\n")},
+		{"logs/mongod.log.gz", gzbuf.Bytes()},
+		{"logs/mongos.log.zst", zstbuf.Bytes()},
+		{"getMongoData.json", []byte("{\n  \"host\": \"db1.prod.acme.com:27017\",\n  \"email\": \"dba@acme.com\"\n}\n")},
+		{"export/users.csv", []byte("name,email\njohn,john@acme.com\n")},
+		{"diagnostic.data/metrics.2024-06-15T10-00-00Z-00000", []byte{0x10, 0x00, 0x00, 0x00, 0x01, 0xff, 0xfe}},
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	for _, m := range members {
+		w, err := writer.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(m.data)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestArchive(t *testing.T, filename string) map[string]string {
+	contents := map[string]string{}
+	err := walkArchive(filename, func(member archiveMember, reader io.Reader) error {
+		dreader, err := NewReader(reader)
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(dreader)
+		contents[member.name] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+func TestObfuscateArchive(t *testing.T) {
+	infile := "/tmp/obfuscate_archive.zip"
+	createTestArchive(t, infile)
+	defer os.Remove(infile)
+
+	for _, outfile := range []string{"/tmp/obfuscate_archive.out.tar.gz", "/tmp/obfuscate_archive.out.zip"} {
+		o := NewObfuscator()
+		if err := o.ObfuscateArchive(infile, outfile, ArchiveOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		contents := readTestArchive(t, outfile)
+		os.Remove(outfile)
+
+		if len(contents) != 6 {
+			t.Fatalf("expected 6 members in %s, got %v", outfile, contents)
+		}
+		renamed := "logs/" + o.ObfuscateFQDN("mongod-db1.prod.acme.com") + ".log"
+		if _, ok := contents[renamed]; !ok {
+			t.Errorf("member with hostname should be renamed to %s, got %v", renamed, contents)
+		}
+		for name, data := range contents {
+			if strings.Contains(name, "acme") {
+				t.Errorf("member name not obfuscated: %s", name)
+			}
+			if strings.Contains(data, "192.168.1.100") || strings.Contains(data, "acme.com") {
+				t.Errorf("member %s not obfuscated: %s", name, data)
+			}
+		}
+		if !strings.HasPrefix(contents["logs/mongod.log.gz"], `{"t":{"$date":`) {
+			t.Errorf("JSON lines member should be obfuscated as JSON, got %s", contents["logs/mongod.log.gz"])
+		}
+		if !strings.HasPrefix(contents["export/users.csv"], "name,email\njohn,") {
+			t.Errorf("CSV member should keep its header, got %s", contents["export/users.csv"])
+		}
+		if contents["diagnostic.data/metrics.2024-06-15T10-00-00Z-00000"] != "\x10\x00\x00\x00\x01\xff\xfe" {
+			t.Error("binary member should be copied unchanged")
+		}
+	}
+}
+
+func TestObfuscateArchiveCompressedMembers(t *testing.T) {
+	infile := filepath.Join(t.TempDir(), "bundle.zip")
+	outfile := filepath.Join(t.TempDir(), "bundle.out.zip")
+	bz2, _ := os.ReadFile("testdata/connection.log.bz2")
+	xz, _ := os.ReadFile("testdata/connection.log.xz")
+	file, _ := os.Create(infile)
+	writer := zip.NewWriter(file)
+	for name, data := range map[string][]byte{"logs/mongod.log.bz2": bz2, "logs/mongod.log.xz": xz} {
+		w, _ := writer.Create(name)
+		w.Write(data)
+	}
+	writer.Close()
+	file.Close()
+
+	o := NewObfuscator()
+	if err := o.ObfuscateArchive(infile, outfile, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	zreader, err := zip.OpenReader(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zreader.Close()
+	contents := map[string]string{}
+	for _, f := range zreader.File {
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(b)
+	}
+	// bzip2 is stored decompressed and obfuscated, xz cannot be decoded and is copied
+	if data, ok := contents["logs/mongod.log"]; !ok || strings.Contains(data, "192.168.1.100") || !strings.Contains(data, "second stream") {
+		t.Errorf("bzip2 member should be obfuscated and stored decompressed, got %v", contents)
+	}
+	if contents["logs/mongod.log.xz"] != string(xz) {
+		t.Errorf("xz member should be copied unchanged")
+	}
+}
+
+func TestObfuscateArchiveSkipBinary(t *testing.T) {
+	infile := "/tmp/obfuscate_archive_skip.zip"
+	outfile := "/tmp/obfuscate_archive_skip.out.zip"
+	createTestArchive(t, infile)
+	defer os.Remove(infile)
+	defer os.Remove(outfile)
+
+	o := NewObfuscator()
+	if err := o.ObfuscateArchive(infile, outfile, ArchiveOptions{BinaryPolicy: BinarySkip}); err != nil {
+		t.Fatal(err)
+	}
+	contents := readTestArchive(t, outfile)
+	if _, ok := contents["diagnostic.data/metrics.2024-06-15T10-00-00Z-00000"]; ok || len(contents) != 5 {
+		t.Errorf("binary member should be skipped, got %v", contents)
+	}
+}
+
+func TestObfuscateJSONLinesOrderAndIntegers(t *testing.T) {
+	o := NewObfuscator()
+	line := `{"t":{"$date":"2024-06-15T10:00:00.000Z"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener",` +
+		`"msg":"Connection accepted","attr":{"connectionId":1234,"big":9007199254740993,"ratio":0.5,"html":"<a>"}}`
+	var out bytes.Buffer
+	if err := o.obfuscateJSONLines(bufio.NewReader(strings.NewReader(line+"\n")), &out); err != nil {
+		t.Fatal(err)
+	}
+	result := out.String()
+	keys := []string{`"t":`, `"s":`, `"c":`, `"id":`, `"ctx":`, `"msg":`, `"attr":`}
+	for i := 1; i < len(keys); i++ {
+		if strings.Index(result, keys[i-1]) > strings.Index(result, keys[i]) {
+			t.Fatalf("keys order not kept: %s", result)
+		}
+	}
+	for _, expected := range []string{
+		fmt.Sprintf(`"id":%d,`, o.ObfuscateInt(22943)),
+		fmt.Sprintf(`"connectionId":%d,`, o.ObfuscateInt(1234)),
+		`"big":8259601716597490,`,
+		`"html":"<a>"`,
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("expected %s in %s", expected, result)
+		}
+	}
+}
+
+func TestObfuscateArchiveIPMemberName(t *testing.T) {
+	dir := t.TempDir()
+	infile := filepath.Join(dir, "bundle.zip")
+	file, _ := os.Create(infile)
+	writer := zip.NewWriter(file)
+	w, _ := writer.Create("10.20.30.40/mongod.log.gz")
+	gz := gzip.NewWriter(w)
+	gz.Write([]byte("hello\n"))
+	gz.Close()
+	writer.Close()
+	file.Close()
+
+	o := NewObfuscator()
+	outfile := filepath.Join(dir, "bundle.out.zip")
+	if err := o.ObfuscateArchive(infile, outfile, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	zreader, err := zip.OpenReader(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zreader.Close()
+	expected := o.ObfuscateIP("10.20.30.40") + "/mongod.log.gz"
+	if len(zreader.File) != 1 || zreader.File[0].Name != expected || zreader.File[0].Method != zip.Store {
+		t.Errorf("expected stored member %s, got %s", expected, zreader.File[0].Name)
+	}
+}
+
+func TestObfuscateArchiveError(t *testing.T) {
+	dir := t.TempDir()
+	infile := filepath.Join(dir, "bundle.zip")
+	file, _ := os.Create(infile)
+	writer := zip.NewWriter(file)
+	writer.Create("first.log")
+	w, _ := writer.Create("second.log.gz")
+	w.Write([]byte{0x1f, 0x8b, 0x08, 0x00, 0x00}) // truncated gzip
+	writer.Close()
+	file.Close()
+
+	outfile := filepath.Join(dir, "bundle.out.zip")
+	if err := NewObfuscator().ObfuscateArchive(infile, outfile, ArchiveOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("partial output should be removed, got %v", entries)
+	}
+}
+
+func TestObfuscateArchiveRawSnappyMember(t *testing.T) {
+	dir := t.TempDir()
+	infile := filepath.Join(dir, "bundle.zip")
+	file, _ := os.Create(infile)
+	writer := zip.NewWriter(file)
+	w, _ := writer.Create("logs/mongod.log.sz")
+	w.Write(snappy.Encode(nil, []byte("connection accepted from 192.168.1.100:51234\n")))
+	writer.Close()
+	file.Close()
+
+	outfile := filepath.Join(dir, "bundle.out.zip")
+	if err := NewObfuscator().ObfuscateArchive(infile, outfile, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	contents := readTestArchive(t, outfile)
+	// a raw snappy block is stored decompressed
+	if data, ok := contents["logs/mongod.log"]; !ok || !strings.HasPrefix(data, "connection accepted from ") ||
+		strings.Contains(data, "192.168.1.100") {
+		t.Errorf("raw snappy member should be obfuscated and stored decompressed, got %v", contents)
+	}
+}
+
+func TestObfuscateArchiveAudit(t *testing.T) {
+	dir := t.TempDir()
+	infile := filepath.Join(dir, "bundle.zip")
+	file, _ := os.Create(infile)
+	writer := zip.NewWriter(file)
+	w, _ := writer.Create("db1.acme.com/mongod.log")
+	w.Write([]byte("connection accepted from 192.168.1.100:51234\n"))
+	writer.Close()
+	file.Close()
+
+	var buf bytes.Buffer
+	o := NewObfuscator()
+	o.Audit = NewAuditLog(&buf)
+	if err := o.ObfuscateArchive(infile, filepath.Join(dir, "bundle.out.zip"), ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	o.Audit.Close()
+	for _, plaintext := range []string{"db1", "acme", "192.168.1.100"} {
+		if strings.Contains(buf.String(), plaintext) {
+			t.Errorf("audit log should not contain %s, got %s", plaintext, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), `"file":"`+o.ObfuscateFQDN("db1.acme.com")+`/mongod.log"`) {
+		t.Errorf("audit records should carry the obfuscated member name, got %s", buf.String())
+	}
+}
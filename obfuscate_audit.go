@@ -0,0 +1,119 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_audit.go
+
+package gox
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// AuditRecord describes a single obfuscation replacement
+type AuditRecord struct {
+	File        string `json:"file,omitempty"`   // Archive member or file name
+	Line        int    `json:"line,omitempty"`   // 1-based line or record number of text input
+	Offset      int64  `json:"offset,omitempty"` // Byte offset of the line in text input
+	Path        string `json:"path,omitempty"`   // Field path, such as attr.remote or a CSV column
+	Rule        string `json:"rule"`             // Rule category, such as ip or email
+	Hash        string `json:"hash,omitempty"`   // Keyed hash of the original value, empty without a SecretKey
+	Replacement string `json:"replacement"`
+}
+
+// AuditLog writes obfuscation decisions as JSON lines
+// The output has no timestamps so that two runs over the same input are identical. Originals are identified by
+// HMAC-SHA256 keyed by the Obfuscator SecretKey, since unkeyed hashes of IPs, SSNs or phone numbers are easily
+// reversed, and are left out if no key is set
+type AuditLog struct {
+	Counts map[string]int // Number of replacements per rule
+
+	encoder *json.Encoder
+	err     error
+	file    string
+	line    int
+	offset  int64
+	path    []string
+}
+
+// NewAuditLog returns an audit log writing JSON lines to writer
+func NewAuditLog(writer io.Writer) *AuditLog {
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	return &AuditLog{Counts: make(map[string]int), encoder: encoder}
+}
+
+// Close writes the summary of counts per rule and returns the first write error
+func (a *AuditLog) Close() error {
+	if a.err != nil {
+		return a.err
+	}
+	total := 0
+	for _, count := range a.Counts {
+		total += count
+	}
+	return a.encoder.Encode(map[string]interface{}{"summary": a.Counts, "total": total})
+}
+
+// audit records a replacement of original by replacement under rule, if an audit log is set
+func (o *Obfuscator) audit(rule string, original string, replacement string) {
+	if o.Audit == nil || original == replacement {
+		return
+	}
+	hash := ""
+	if o.SecretKey != "" {
+		hash = hex.EncodeToString(o.derive("audit", original, 0)[:16])
+	}
+	o.Audit.record(rule, hash, replacement)
+}
+
+// record writes a replacement under rule with the keyed hash of the original
+func (a *AuditLog) record(rule string, hash string, replacement string) {
+	a.Counts[rule]++
+	if a.err != nil {
+		return
+	}
+	a.err = a.encoder.Encode(AuditRecord{File: a.file, Line: a.line, Offset: a.offset,
+		Path: strings.Join(a.path, "."), Rule: rule, Hash: hash, Replacement: replacement})
+}
+
+// setFile sets the file name of following records and resets the line position
+func (a *AuditLog) setFile(file string) {
+	if a == nil {
+		return
+	}
+	a.file, a.line, a.offset = file, 0, 0
+}
+
+// setLine sets the line position of following records
+func (a *AuditLog) setLine(line int, offset int64) {
+	if a == nil {
+		return
+	}
+	a.line, a.offset = line, offset
+}
+
+// enter appends a field name or array index to the current path
+func (a *AuditLog) enter(key string) {
+	if a == nil {
+		return
+	}
+	a.path = append(a.path, key)
+}
+
+// enterIndex appends an array index to the current path
+func (a *AuditLog) enterIndex(i int) {
+	if a == nil {
+		return
+	}
+	a.path = append(a.path, strconv.Itoa(i))
+}
+
+// leave removes the last field name or array index from the current path
+func (a *AuditLog) leave() {
+	if a == nil || len(a.path) == 0 {
+		return
+	}
+	a.path = a.path[:len(a.path)-1]
+}
@@ -0,0 +1,106 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_audit_test.go
+
+package gox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func auditMap(t *testing.T, key string) string {
+	var buf bytes.Buffer
+	o := NewObfuscator()
+	o.SecretKey = key
+	o.Audit = NewAuditLog(&buf)
+	doc := map[string]interface{}{
+		"phone": "555-123-4567",
+		"hosts": []interface{}{"192.168.1.100", "192.168.1.101"},
+		"nested": map[string]interface{}{
+			"ip":  "192.168.1.100",
+			"ssn": "123-45-6789",
+		},
+	}
+	o.ObfuscateMap(doc)
+	if err := o.Audit.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestAuditLog(t *testing.T) {
+	output := auditMap(t, "customer secret")
+	if output != auditMap(t, "customer secret") {
+		t.Fatal("audit output should be reproducible")
+	}
+	for _, plaintext := range []string{"555-123-4567", "192.168.1.100", "123-45-6789"} {
+		if strings.Contains(output, plaintext) {
+			t.Errorf("audit output should not contain %s", plaintext)
+		}
+	}
+
+	var records []AuditRecord
+	var summary struct {
+		Summary map[string]int `json:"summary"`
+		Total   int            `json:"total"`
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{}
+	for _, record := range records {
+		paths = append(paths, record.Path+":"+record.Rule)
+	}
+	expected := "hosts.0:ip,hosts.1:ip,nested.ip:ip,nested.ssn:ssn,phone:phone"
+	if strings.Join(paths, ",") != expected {
+		t.Errorf("audit paths = %s, expected %s", strings.Join(paths, ","), expected)
+	}
+	o := NewObfuscator()
+	o.SecretKey = "customer secret"
+	if records[0].Hash != hex.EncodeToString(o.derive("audit", "192.168.1.100", 0)[:16]) || records[0].Hash != records[2].Hash {
+		t.Errorf("audit should record the keyed hash of the original, got %s", records[0].Hash)
+	}
+	if records[0].Hash == records[1].Hash || auditMap(t, "other secret") == output {
+		t.Error("audit hashes should depend on the original and the key")
+	}
+	if strings.Contains(auditMap(t, ""), `"hash"`) {
+		t.Error("audit should not record hashes without a key")
+	}
+	if summary.Summary["ip"] != 3 || summary.Total != 5 {
+		t.Errorf("unexpected summary %v", summary)
+	}
+}
+
+func TestAuditLogText(t *testing.T) {
+	var buf bytes.Buffer
+	o := NewObfuscator()
+	o.Audit = NewAuditLog(&buf)
+	input := "nothing here\nfrom 192.168.1.100\n"
+	if err := o.ObfuscateText(strings.NewReader(input), io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	var record AuditRecord
+	reader := bufio.NewReader(&buf)
+	line, _ := reader.ReadString('\n')
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Line != 2 || record.Offset != 13 || record.Rule != "ip" {
+		t.Errorf("unexpected audit record %+v", record)
+	}
+}
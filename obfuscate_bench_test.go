@@ -0,0 +1,135 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_bench_test.go
+
+package gox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// benchLogLines are typical mongod 4.4+ structured log lines
+var benchLogLines = []string{
+	`{"t":{"$date":"2024-03-15T10:21:03.123+00:00"},"s":"I",  "c":"NETWORK",  "id":22943,   "ctx":"listener","msg":"Connection accepted","attr":{"remote":"10.20.30.40:51234","uuid":"3b241101-e2bb-4255-8caf-4136c566a962","connectionId":1234,"connectionCount":57}}`,
+	`{"t":{"$date":"2024-03-15T10:21:03.456+00:00"},"s":"I",  "c":"COMMAND",  "id":51803,   "ctx":"conn1234","msg":"Slow query","attr":{"type":"command","ns":"acme.orders","command":{"find":"orders","filter":{"customerId":{"$oid":"507f1f77bcf86cd799439011"},"status":"shipped"},"$db":"acme"},"planSummary":"IXSCAN { customerId: 1 }","keysExamined":120,"docsExamined":120,"nreturned":120,"durationMillis":152}}`,
+	`{"t":{"$date":"2024-03-15T10:21:04.001+00:00"},"s":"I",  "c":"REPL",     "id":21215,   "ctx":"ReplCoord-1","msg":"Member is in new state","attr":{"hostAndPort":"db2.prod.acme.com:27017","newState":"SECONDARY"}}`,
+	`{"t":{"$date":"2024-03-15T10:21:04.500+00:00"},"s":"I",  "c":"ACCESS",   "id":20250,   "ctx":"conn1235","msg":"Authentication succeeded","attr":{"mechanism":"SCRAM-SHA-256","speculative":true,"principalName":"appUser","authenticationDatabase":"admin","remote":"10.20.30.41:52011","extraInfo":{}}}`,
+	`{"t":{"$date":"2024-03-15T10:21:05.000+00:00"},"s":"I",  "c":"NETWORK",  "id":22944,   "ctx":"conn1233","msg":"Connection ended","attr":{"remote":"10.20.30.42:50123","connectionId":1233,"connectionCount":56}}`,
+	`{"t":{"$date":"2024-03-15T10:21:05.250+00:00"},"s":"I",  "c":"STORAGE",  "id":22430,   "ctx":"WTCheckpointThread","msg":"WiredTiger message","attr":{"message":"[1710498065:250123][1234:0x7f1c2a3b4700], WT_SESSION.checkpoint: [WT_VERB_CHECKPOINT_PROGRESS] saving checkpoint snapshot min: 1234, snapshot max: 1234"}}`,
+}
+
+func BenchmarkObfuscateString(b *testing.B) {
+	o := NewObfuscator()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, line := range benchLogLines {
+			o.ObfuscateString(line)
+		}
+	}
+}
+
+func BenchmarkObfuscateBytes(b *testing.B) {
+	o := NewObfuscator()
+	lines := make([][]byte, len(benchLogLines))
+	for i, line := range benchLogLines {
+		lines[i] = []byte(line)
+	}
+	var buf []byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			buf = o.ObfuscateBytes(buf[:0], line)
+		}
+	}
+}
+
+func BenchmarkObfuscateText(b *testing.B) {
+	o := NewObfuscator()
+	text := strings.Repeat(strings.Join(benchLogLines, "\n")+"\n", 100)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		o.ObfuscateText(strings.NewReader(text), io.Discard)
+	}
+}
+
+func BenchmarkHashIndex(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		HashIndex("db1.prod.acme.com", len(Cities))
+	}
+}
+
+func BenchmarkHashOctet(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		HashOctet("192.168.1.100", 2)
+	}
+}
+
+func BenchmarkLooksLikeHostPort(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		LooksLikeHostPort("db1.prod.acme.com:27017")
+	}
+}
+
+func TestObfuscateStringNoCandidates(t *testing.T) {
+	o := NewObfuscator()
+	plain := "no sensitive values here"
+	if result := o.ObfuscateString(plain); result != plain {
+		t.Errorf("ObfuscateString = %s, expected %s", result, plain)
+	}
+}
+
+func TestObfuscateBytes(t *testing.T) {
+	o := NewObfuscator()
+	for _, line := range benchLogLines {
+		expected := o.ObfuscateString(line)
+		if result := o.ObfuscateBytes(nil, []byte(line)); string(result) != expected {
+			t.Errorf("ObfuscateBytes = %s, expected %s", result, expected)
+		}
+	}
+	plain := []byte("no sensitive values here")
+	if result := o.ObfuscateBytes([]byte("> "), plain); !bytes.Equal(result, []byte("> no sensitive values here")) {
+		t.Errorf("ObfuscateBytes should append to dst, got %s", result)
+	}
+}
+
+func TestScannersMatchRegex(t *testing.T) {
+	inputs := []string{"", "1234.5.6.7", "1.2.3", "v10.20.30.40:51234 and 10.20.30.41", "1.2.3.4.5.6", "999.1.1.1999",
+		"ts 10:2 then :27017 and :1", "a::12", "3b241101-e2bb-4255-8caf-4136c566a962", "x3b241101-e2bb-4255-8caf-4136c566a962",
+		"_3B241101-E2BB-4255-8CAF-4136C566A962 3b241101-e2bb-4255-8caf-4136c566a962.log",
+		"13b241101-e2bb-4255-8caf-4136c566a962-3b241101-e2bb-4255-8caf-4136c566a962"}
+	locs := func(start int, end int) []int {
+		if start < 0 {
+			return nil
+		}
+		return []int{start, end}
+	}
+	for _, s := range inputs {
+		if ip, expected := locs(indexIP(s)), ReIP.FindStringIndex(s); fmt.Sprint(ip) != fmt.Sprint(expected) {
+			t.Errorf("indexIP(%q) = %v, expected %v", s, ip, expected)
+		}
+		if port, expected := locs(indexPort(s)), RePort.FindStringIndex(s); fmt.Sprint(port) != fmt.Sprint(expected) {
+			t.Errorf("indexPort(%q) = %v, expected %v", s, port, expected)
+		}
+		if uuids, expected := uuidIndexes(s), ReUUID.FindAllStringIndex(s, -1); fmt.Sprint(uuids) != fmt.Sprint(expected) {
+			t.Errorf("uuidIndexes(%q) = %v, expected %v", s, uuids, expected)
+		}
+	}
+}
+
+func TestUnshield(t *testing.T) {
+	shielded := []string{"zero", "one"}
+	value := "a" + placeholder(1) + "b\x00\x00" + placeholder(0) + placeholder(27) + "\x00C"
+	if result := unshield(value, shielded); result != "aoneb\x00\x00zero"+placeholder(27)+"\x00C" {
+		t.Errorf("unshield = %q", result)
+	}
+	if placeholder(27) != "\x00BB\x00" {
+		t.Errorf("placeholder(27) = %q", placeholder(27))
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_cloud.go
+
+package gox
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Pre-compiled regex patterns for cloud resource identifiers
+var (
+	ReARN          = regexp.MustCompile(`\barn:aws[a-z-]*:[a-z0-9-]+:[a-z0-9-]*:\d{0,12}:[A-Za-z0-9_+=.@/:-]+`)
+	ReAzureID      = regexp.MustCompile(`(?i)/subscriptions/[0-9a-f-]{36}(/[^/\s"',]+)*`)
+	ReAzureVault   = regexp.MustCompile(`\b[a-z0-9-]+\.vault\.azure\.net(/(keys|secrets|certificates)/[^/\s"',]+(/[0-9a-fA-F]{32})?)?`)
+	ReAzureStorage = regexp.MustCompile(`\b[a-z0-9]{3,24}\.(blob|dfs|file|queue|table)\.core\.windows\.net`)
+	ReGCPResource  = regexp.MustCompile(`\bprojects/[a-z][a-z0-9-]{4,28}[a-z0-9](/[^/\s"',]+)*`)
+	ReBucketURL    = regexp.MustCompile(`\b(s3|gs)://[a-z0-9][a-z0-9._-]*[a-z0-9]`)
+	ReS3Host       = regexp.MustCompile(`\b[a-z0-9][a-z0-9.-]*[a-z0-9]\.s3[.-]([a-z0-9-]+\.)?amazonaws\.com`)
+	ReS3Path       = regexp.MustCompile(`\bs3[.-]([a-z0-9-]+\.)?amazonaws\.com/[a-z0-9][a-z0-9._-]*[a-z0-9]`)
+)
+
+// ObfuscateARN obfuscates the account and resource names of an AWS ARN
+// Partition, service, region and resource types are kept
+func (o *Obfuscator) ObfuscateARN(arn string) string {
+	trimmed := strings.TrimRight(arn, ".:/")
+	suffix := arn[len(trimmed):]
+	parts := strings.SplitN(trimmed, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return arn
+	}
+	if parts[4] != "" {
+		parts[4] = o.obfuscateAccountID(parts[4])
+	}
+
+	// Resource is type/name, type:name or a plain name; S3 resources start with the bucket name
+	tokens := strings.FieldsFunc(parts[5], func(r rune) bool { return r == '/' || r == ':' })
+	start := 0
+	if parts[2] != "s3" && len(tokens) > 1 {
+		start = 1
+	}
+	end := len(tokens)
+	if parts[2] == "s3" {
+		end = 1
+	}
+	resource := parts[5]
+	pos := 0
+	for i, token := range tokens {
+		j := pos + strings.Index(resource[pos:], token)
+		if i >= start && i < end {
+			newToken := o.obfuscateCloudName(token)
+			resource = resource[:j] + newToken + resource[j+len(token):]
+			token = newToken
+		}
+		pos = j + len(token)
+	}
+	parts[5] = resource
+	return strings.Join(parts, ":") + suffix
+}
+
+// ObfuscateResourcePath obfuscates names in Azure resource IDs and GCP resource paths
+// Collection keys, providers and locations are kept, such as
+// /subscriptions/{id}/resourceGroups/{name}/providers/Microsoft.KeyVault/vaults/{name}
+// and projects/{name}/locations/us-east1/keyRings/{name}/cryptoKeys/{name}
+func (o *Obfuscator) ObfuscateResourcePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i] == "" {
+			continue
+		}
+		switch strings.ToLower(segments[i]) {
+		case "providers", "locations", "regions", "zones":
+		default:
+			segments[i+1] = o.obfuscateCloudName(segments[i+1])
+		}
+		i++
+	}
+	return strings.Join(segments, "/")
+}
+
+// ObfuscateBucketURL obfuscates bucket names in s3://, gs:// and Amazon S3 URLs
+func (o *Obfuscator) ObfuscateBucketURL(value string) string {
+	value = ReBucketURL.ReplaceAllStringFunc(value, func(matched string) string {
+		i := strings.Index(matched, "://") + 3
+		return matched[:i] + o.obfuscateCloudName(matched[i:])
+	})
+	value = ReS3Host.ReplaceAllStringFunc(value, func(matched string) string {
+		i := strings.LastIndex(matched[:len(matched)-len(".amazonaws.com")], ".s3")
+		return o.obfuscateCloudName(matched[:i]) + matched[i:]
+	})
+	value = ReS3Path.ReplaceAllStringFunc(value, func(matched string) string {
+		i := strings.Index(matched, "/") + 1
+		return matched[:i] + o.obfuscateCloudName(matched[i:])
+	})
+	return value
+}
+
+// shieldCloud replaces cloud resource identifiers with placeholders
+func (o *Obfuscator) shieldCloud(value string, shielded *[]string) string {
+	if strings.Contains(value, "arn:aws") {
+		value = shield(value, ReARN, o.ObfuscateARN, shielded)
+	}
+	if containsFold(value, "/subscriptions/") {
+		value = shield(value, ReAzureID, o.ObfuscateResourcePath, shielded)
+	}
+	if strings.Contains(value, "projects/") {
+		value = shield(value, ReGCPResource, o.ObfuscateResourcePath, shielded)
+	}
+	// Remaining patterns need a .net or amazonaws.com domain, or a bucket URL
+	if !strings.Contains(value, ".net") && !strings.Contains(value, "amazonaws.com") && !strings.Contains(value, "://") {
+		return value
+	}
+	value = shield(value, ReAzureVault, func(matched string) string {
+		segments := strings.Split(matched, "/")
+		i := strings.Index(segments[0], ".")
+		segments[0] = o.obfuscateCloudName(segments[0][:i]) + segments[0][i:]
+		if len(segments) > 2 {
+			segments[2] = o.obfuscateCloudName(segments[2])
+		}
+		if len(segments) > 3 {
+			segments[3] = o.obfuscateCloudName(segments[3])
+		}
+		return strings.Join(segments, "/")
+	}, shielded)
+	value = shield(value, ReAzureStorage, func(matched string) string {
+		i := strings.Index(matched, ".")
+		return strings.ReplaceAll(o.obfuscateCloudName(matched[:i]), "-", "") + matched[i:]
+	}, shielded)
+	for _, re := range []*regexp.Regexp{ReBucketURL, ReS3Host, ReS3Path} {
+		value = shield(value, re, o.ObfuscateBucketURL, shielded)
+	}
+	return value
+}
+
+// obfuscateAccountID maps an account number to another of the same length
+func (o *Obfuscator) obfuscateAccountID(id string) string {
+	if cached, exists := o.CloudMap[id]; exists {
+		o.audit("cloud", id, cached)
+		return cached
+	}
+	hash := o.hashBytes("account", id, len(id))
+	digits := make([]byte, len(id))
+	for i := range digits {
+		digits[i] = '0' + hash[i]%10
+	}
+	newValue := string(digits)
+	o.CloudMap[id] = newValue
+	o.audit("cloud", id, newValue)
+	return newValue
+}
+
+// obfuscateCloudName maps a project, bucket, vault or key name consistently
+// UUIDs go through ObfuscateUUID and hex versions keep their length, names taken by another input get a counter
+func (o *Obfuscator) obfuscateCloudName(name string) string {
+	if ReUUID.MatchString(name) && len(name) == 36 {
+		return o.ObfuscateUUID(name)
+	}
+	if cached, exists := o.CloudMap[name]; exists {
+		o.audit("cloud", name, cached)
+		return cached
+	}
+
+	var newValue string
+	if len(name) >= 16 && strings.Trim(strings.ToLower(name), "0123456789abcdef") == "" {
+		newValue = matchHexCase(o.hashHex("cloud", name, len(name)), name)
+	} else if o.NameStyle == NameStyleHash {
+		newValue = "res-" + o.hashHex("cloud", name, 8)
+	} else {
+		city := o.pickCity(name)
+		flower := o.pickFlower(name)
+		newValue = strings.ToLower(flower + "-" + city)
+	}
+	newValue = o.uniqueName("cloud", o.CloudMap, newValue)
+	o.CloudMap[name] = newValue
+	o.audit("cloud", name, newValue)
+	return newValue
+}
+
+// containsFold checks if s contains substr under ASCII case folding
+func containsFold(s string, substr string) bool {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_cloud_test.go
+
+package gox
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestObfuscateARN(t *testing.T) {
+	o := NewObfuscator()
+	keyID := "3b241101-e2bb-4255-8caf-4136c566a962"
+	arn := "arn:aws:kms:us-east-1:123456789012:key/" + keyID
+
+	result := o.ObfuscateARN(arn)
+	parts := strings.Split(result, ":")
+	if len(parts) != 6 || parts[2] != "kms" || parts[3] != "us-east-1" {
+		t.Fatalf("provider, service and region should be kept, got %s", result)
+	}
+	if parts[4] == "123456789012" || len(parts[4]) != 12 {
+		t.Errorf("account should be obfuscated with 12 digits, got %s", parts[4])
+	}
+	if parts[5] != "key/"+o.ObfuscateUUID(keyID) {
+		t.Errorf("key ID should map like a UUID, got %s", parts[5])
+	}
+
+	// Same account maps the same in other ARNs
+	role := o.ObfuscateARN("arn:aws:iam::123456789012:role/AcmeBackupRole")
+	if !strings.HasPrefix(role, "arn:aws:iam::"+parts[4]+":role/") || strings.Contains(role, "Acme") {
+		t.Errorf("unexpected role ARN %s", role)
+	}
+
+	bucket := o.ObfuscateARN("arn:aws:s3:::acme-backups/prod/snapshot.tar")
+	if !strings.HasPrefix(bucket, "arn:aws:s3:::") || !strings.HasSuffix(bucket, "/prod/snapshot.tar") ||
+		strings.Contains(bucket, "acme") {
+		t.Errorf("unexpected S3 ARN %s", bucket)
+	}
+}
+
+func TestObfuscateResourcePath(t *testing.T) {
+	o := NewObfuscator()
+	azure := "/subscriptions/3b241101-e2bb-4255-8caf-4136c566a962/resourceGroups/acme-rg/providers/Microsoft.KeyVault/vaults/acme-vault"
+	result := o.ObfuscateResourcePath(azure)
+	segments := strings.Split(result, "/")
+	if segments[1] != "subscriptions" || segments[3] != "resourceGroups" || segments[6] != "Microsoft.KeyVault" ||
+		segments[7] != "vaults" || strings.Contains(result, "acme") || strings.Contains(result, "3b241101") {
+		t.Errorf("unexpected Azure resource ID %s", result)
+	}
+
+	gcp := "projects/acme-prod/locations/us-east1/keyRings/acme-ring/cryptoKeys/acme-key"
+	result = o.ObfuscateResourcePath(gcp)
+	segments = strings.Split(result, "/")
+	if segments[0] != "projects" || segments[3] != "us-east1" || segments[4] != "keyRings" ||
+		strings.Contains(result, "acme") {
+		t.Errorf("unexpected GCP resource path %s", result)
+	}
+}
+
+func TestObfuscateStringCloud(t *testing.T) {
+	o := NewObfuscator()
+	bucket := o.obfuscateCloudName("acme-backups")
+	project := o.obfuscateCloudName("acme-prod")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"backup to s3://acme-backups/daily", "backup to s3://" + bucket + "/daily"},
+		{"https://acme-backups.s3.us-east-1.amazonaws.com/daily", "https://" + bucket + ".s3.us-east-1.amazonaws.com/daily"},
+		{"https://s3.amazonaws.com/acme-backups/daily", "https://s3.amazonaws.com/" + bucket + "/daily"},
+		{"gs://acme-backups", "gs://" + bucket},
+		{`"keyName": "projects/acme-prod/locations/global"`, `"keyName": "projects/` + project + `/locations/global"`},
+	}
+	for _, tc := range tests {
+		if result := o.ObfuscateString(tc.input); result != tc.expected {
+			t.Errorf("ObfuscateString(%q) = %q, expected %q", tc.input, result, tc.expected)
+		}
+	}
+
+	vault := o.ObfuscateString("https://acmevault.vault.azure.net/keys/acme-key/0123456789abcdef0123456789abcdef")
+	if strings.Contains(vault, "acme") || strings.Contains(vault, "0123456789abcdef") ||
+		!strings.Contains(vault, ".vault.azure.net/keys/") {
+		t.Errorf("unexpected key vault URL %s", vault)
+	}
+	storage := o.ObfuscateString("https://acmestorage.blob.core.windows.net/backups")
+	if strings.Contains(storage, "acme") || !strings.Contains(storage, ".blob.core.windows.net/backups") {
+		t.Errorf("unexpected storage URL %s", storage)
+	}
+	arn := o.ObfuscateString(`{"kmsKey": "arn:aws:kms:us-east-1:123456789012:alias/acme-key", "port": ":27017"}`)
+	if strings.Contains(arn, "123456789012") || strings.Contains(arn, "acme") || !strings.Contains(arn, ":us-east-1:") {
+		t.Errorf("unexpected ARN in text %s", arn)
+	}
+}
+
+func TestObfuscateCloudNameCollisions(t *testing.T) {
+	o := NewObfuscator()
+	seen := map[string]string{}
+	for i := 1; i <= 200; i++ {
+		name := fmt.Sprintf("acme-backups-%d", i)
+		result := o.obfuscateCloudName(name)
+		if other, ok := seen[result]; ok {
+			t.Fatalf("%s and %s both map to %s", other, name, result)
+		}
+		seen[result] = name
+		if o.obfuscateCloudName(name) != result {
+			t.Fatalf("%s should map consistently", name)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_config.go
+
+package gox
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Pre-compiled regex patterns for YAML and INI configuration lines
+var (
+	ReConfigINI  = regexp.MustCompile(`^(\s*)([A-Za-z_][A-Za-z0-9_.]*)(\s*=\s*)(.*)$`)
+	ReConfigYAML = regexp.MustCompile(`^(\s*)([A-Za-z_$][A-Za-z0-9_.$-]*)(\s*:)(\s*)(.*)$`)
+	ReConfigList = regexp.MustCompile(`^(\s*)(-\s+)(.*)$`)
+	ReConfigItem = regexp.MustCompile(`[^,;\s]+`)
+)
+
+// configDirs are path segments kept by ObfuscatePath
+var configDirs = map[string]bool{
+	"bin": true, "ca": true, "cert": true, "certs": true, "client": true, "data": true, "db": true,
+	"etc": true, "home": true, "journal": true, "keyfile": true, "keys": true, "lib": true, "local": true,
+	"log": true, "logs": true, "mongo": true, "mongod": true, "mongodb": true, "mongos": true, "opt": true,
+	"pki": true, "private": true, "run": true, "server": true, "share": true, "srv": true, "ssl": true,
+	"tls": true, "tmp": true, "usr": true, "var": true,
+}
+
+// configStack tracks YAML keys by indentation
+type configStack struct {
+	indents []int
+	keys    []string
+}
+
+// ObfuscateConfigFile obfuscates a mongod.conf YAML or legacy key=value file into outfile
+// An empty outfile writes the file back in place
+func (o *Obfuscator) ObfuscateConfigFile(infile string, outfile string) error {
+	var err error
+	var file, out *os.File
+
+	if file, err = os.Open(infile); err != nil {
+		return err
+	}
+	defer file.Close()
+	if outfile == "" {
+		outfile = infile
+	}
+	if out, err = os.CreateTemp(filepath.Dir(outfile), ".gox-config-"); err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if err = o.ObfuscateConfig(file, out); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	if info, err := file.Stat(); err == nil {
+		os.Chmod(out.Name(), info.Mode().Perm())
+	}
+	return os.Rename(out.Name(), outfile)
+}
+
+// ObfuscateConfig obfuscates a YAML or INI configuration stream line by line
+// Only values are rewritten, comments and formatting are kept
+func (o *Obfuscator) ObfuscateConfig(reader io.Reader, writer io.Writer) error {
+	br := bufio.NewReader(reader)
+	bw := bufio.NewWriter(writer)
+	stack := &configStack{}
+	for n := 1; ; n++ {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			o.Audit.setLine(n, 0)
+			text := strings.TrimRight(line, "\r\n")
+			bw.WriteString(o.obfuscateConfigLine(text, stack))
+			bw.WriteString(line[len(text):])
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// obfuscateConfigLine obfuscates the value of a key: value, key=value or - item line
+func (o *Obfuscator) obfuscateConfigLine(line string, stack *configStack) string {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' || trimmed[0] == '[' || trimmed == "---" {
+		return line
+	}
+
+	if m := ReConfigINI.FindStringSubmatch(line); m != nil && !strings.Contains(m[2], ":") {
+		return m[1] + m[2] + m[3] + o.obfuscateConfigScalar(m[2], m[4])
+	}
+	if m := ReConfigYAML.FindStringSubmatch(line); m != nil {
+		indent := len(m[1])
+		stack.pop(indent)
+		path := stack.path(m[2])
+		value, _ := splitConfigComment(m[5])
+		if value == "" {
+			stack.push(indent, m[2])
+			return line
+		}
+		return m[1] + m[2] + m[3] + m[4] + o.obfuscateConfigScalar(path, m[5])
+	}
+	if m := ReConfigList.FindStringSubmatch(line); m != nil {
+		stack.pop(len(m[1]) + 1)
+		if len(stack.keys) == 0 {
+			return line
+		}
+		return m[1] + m[2] + o.obfuscateConfigScalar(strings.Join(stack.keys, "."), m[3])
+	}
+	return line
+}
+
+// obfuscateConfigScalar obfuscates a value with an optional trailing comment, quotes or flow list
+func (o *Obfuscator) obfuscateConfigScalar(path string, raw string) string {
+	value, comment := splitConfigComment(raw)
+	o.Audit.enter(path)
+	defer o.Audit.leave()
+
+	if len(value) >= 2 && value[0] == '[' && value[len(value)-1] == ']' {
+		items := strings.Split(value[1:len(value)-1], ",")
+		for i, item := range items {
+			lead := item[:len(item)-len(strings.TrimLeft(item, " "))]
+			trail := item[len(strings.TrimRight(item, " ")):]
+			items[i] = lead + o.obfuscateConfigQuoted(path, strings.TrimSpace(item)) + trail
+		}
+		return "[" + strings.Join(items, ",") + "]" + comment
+	}
+	return o.obfuscateConfigQuoted(path, value) + comment
+}
+
+// obfuscateConfigQuoted obfuscates a possibly quoted value, keeping the quotes
+func (o *Obfuscator) obfuscateConfigQuoted(path string, value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[:1] + o.obfuscateConfigValue(path, value[1:len(value)-1]) + value[:1]
+	}
+	return o.obfuscateConfigValue(path, value)
+}
+
+// obfuscateConfigValue applies the rule for a configuration field, such as net.bindIp or storage.dbPath
+func (o *Obfuscator) obfuscateConfigValue(path string, value string) string {
+	if value == "" {
+		return value
+	}
+	key := strings.ToLower(path[strings.LastIndex(path, ".")+1:])
+	switch {
+	case strings.Contains(key, "password"):
+		o.audit("password", value, "********")
+		return "********"
+	case key == "bindip" || key == "bind_ip":
+		hosts := strings.Split(value, ",")
+		for i, host := range hosts {
+			name := strings.TrimSpace(host)
+			switch {
+			case name == "localhost" || name == "127.0.0.1" || name == "::1" || name == "0.0.0.0" || name == "*":
+			case name != "":
+				// the same mapping as the host in seed lists and elsewhere in text
+				hosts[i] = strings.Replace(host, name, o.obfuscateHost(name), 1)
+			}
+		}
+		return strings.Join(hosts, ",")
+	case key == "replsetname" || key == "replset" || key == "replicaset" || key == "configdb":
+		if strings.Contains(value, "/") {
+			return o.ObfuscateSeedList(value)
+		}
+		if key == "configdb" {
+			members := strings.Split(value, ",")
+			for i, member := range members {
+				members[i] = o.obfuscateSeedMember(member)
+			}
+			return strings.Join(members, ",")
+		}
+		return o.ObfuscateReplSet(value)
+	case strings.HasSuffix(key, "path") || strings.HasSuffix(key, "file") || strings.HasSuffix(key, "dir"):
+		if strings.ContainsAny(value, `/\`) {
+			return o.ObfuscatePath(value)
+		}
+	}
+	if strings.Contains(value, "mongodb") || ReSeedList.MatchString(value) {
+		// seed lists and connection strings are recognized as a whole
+		return o.ObfuscateString(value)
+	}
+	// lists, such as LDAP servers, item by item so that every host is replaced
+	return ReConfigItem.ReplaceAllStringFunc(value, o.obfuscateConfigItem)
+}
+
+// obfuscateConfigItem obfuscates a list item, with the host of a URL, such as ldaps://host:636/dc=acme, on its own
+func (o *Obfuscator) obfuscateConfigItem(item string) string {
+	i := strings.Index(item, "://")
+	if i <= 0 {
+		return o.ObfuscateString(item)
+	}
+	host, rest := item[i+3:], ""
+	if j := strings.IndexByte(host, '/'); j >= 0 {
+		host, rest = host[:j], host[j:]
+	}
+	return item[:i+3] + o.ObfuscateString(host) + o.ObfuscateString(rest)
+}
+
+// ObfuscatePath obfuscates directory and file names consistently
+// Common system directories, such as /var/lib/mongodb, and file extensions are kept
+func (o *Obfuscator) ObfuscatePath(path string) string {
+	sep := "/"
+	if !strings.Contains(path, "/") && strings.Contains(path, `\`) {
+		sep = `\`
+	}
+	segments := strings.Split(path, sep)
+	for i, segment := range segments {
+		ext := filepath.Ext(segment)
+		if ext == segment || len(ext) > 6 {
+			ext = ""
+		}
+		stem := segment[:len(segment)-len(ext)]
+		if stem == "" || stem == "." || stem == ".." || strings.HasSuffix(stem, ":") || configDirs[strings.ToLower(stem)] {
+			continue
+		}
+		segments[i] = o.obfuscatePathSegment(stem) + ext
+	}
+	return strings.Join(segments, sep)
+}
+
+// obfuscatePathSegment maps a directory or file name consistently
+func (o *Obfuscator) obfuscatePathSegment(name string) string {
+	if cached, exists := o.PathMap[name]; exists {
+		o.audit("path", name, cached)
+		return cached
+	}
+	var newValue string
+	if o.NameStyle == NameStyleHash {
+		newValue = "p-" + o.hashHex("path", name, 8)
+	} else {
+		city := o.pickCity(name)
+		flower := o.pickFlower(name)
+		newValue = strings.ToLower(flower + "-" + city)
+	}
+	o.PathMap[name] = newValue
+	o.audit("path", name, newValue)
+	return newValue
+}
+
+// splitConfigComment splits a value from a trailing # comment outside of quotes
+func splitConfigComment(raw string) (string, string) {
+	var quote byte
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || raw[i-1] == ' ' || raw[i-1] == '\t'):
+			value := strings.TrimRight(raw[:i], " \t")
+			return value, raw[len(value):]
+		}
+	}
+	value := strings.TrimRight(raw, " \t")
+	return value, raw[len(value):]
+}
+
+// pop removes keys at or deeper than indent
+func (s *configStack) pop(indent int) {
+	for len(s.indents) > 0 && s.indents[len(s.indents)-1] >= indent {
+		s.indents = s.indents[:len(s.indents)-1]
+		s.keys = s.keys[:len(s.keys)-1]
+	}
+}
+
+// push adds a parent key at indent
+func (s *configStack) push(indent int, key string) {
+	s.indents = append(s.indents, indent)
+	s.keys = append(s.keys, key)
+}
+
+// path returns the dotted path of key under the current parents
+func (s *configStack) path(key string) string {
+	return strings.Join(append(append([]string{}, s.keys...), key), ".")
+}
@@ -0,0 +1,179 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_config_test.go
+
+package gox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestObfuscateConfig(t *testing.T) {
+	o := NewObfuscator()
+	conf := "# mongod.conf\r\n" +
+		"storage:\r\n" +
+		"  dbPath: /data/acme/db   # data files\r\n" +
+		"systemLog:\r\n" +
+		"  destination: file\r\n" +
+		"  path: \"/var/log/acme/mongod.log\"\r\n" +
+		"net:\r\n" +
+		"  port: 27017\r\n" +
+		"  bindIp: localhost,10.1.2.3,db1.acme.com\r\n" +
+		"  tls:\r\n" +
+		"    mode: requireTLS\r\n" +
+		"    certificateKeyFile: /etc/ssl/acme.pem\r\n" +
+		"    certificateKeyFilePassword: 's3cret'\r\n" +
+		"security:\r\n" +
+		"  keyFile: /etc/acme/keyfile\r\n" +
+		"replication:\r\n" +
+		"  replSetName: acmeProdRS\r\n" +
+		"security:\r\n" +
+		"  ldap:\r\n" +
+		"    servers: \"ldap1.acme.com,ldap2.acme.com db1.acme.com\"\r\n" +
+		"    userToDNMapping: ldaps://ldap1.acme.com,ldaps://ldap3.acme.com\r\n"
+
+	var buf bytes.Buffer
+	if err := o.ObfuscateConfig(strings.NewReader(conf), &buf); err != nil {
+		t.Fatal(err)
+	}
+	result := buf.String()
+	if strings.Contains(result, "acme") || strings.Contains(result, "s3cret") || strings.Contains(result, "10.1.2.3") {
+		t.Errorf("sensitive values should be obfuscated, got\n%s", result)
+	}
+
+	lines := strings.Split(result, "\r\n")
+	acme := o.ObfuscatePath("/acme")[1:]
+	tests := []struct {
+		line     int
+		expected string
+	}{
+		{0, "# mongod.conf"},
+		{2, "  dbPath: /data/" + acme + "/db   # data files"},
+		{4, "  destination: file"},
+		{5, `  path: "/var/log/` + acme + `/mongod.log"`},
+		{7, "  port: 27017"},
+		{8, "  bindIp: localhost," + o.ObfuscateIP("10.1.2.3") + "," + o.ObfuscateFQDN("db1.acme.com")},
+		{10, "    mode: requireTLS"},
+		{11, "    certificateKeyFile: /etc/ssl/" + acme + ".pem"},
+		{12, "    certificateKeyFilePassword: '********'"},
+		{14, "  keyFile: /etc/" + acme + "/keyfile"},
+		{16, "  replSetName: " + o.ObfuscateReplSet("acmeProdRS")},
+		{19, `    servers: "` + o.ObfuscateFQDN("ldap1.acme.com") + "," + o.ObfuscateFQDN("ldap2.acme.com") + " " +
+			o.ObfuscateString("db1.acme.com") + `"`},
+		{20, "    userToDNMapping: ldaps://" + o.ObfuscateFQDN("ldap1.acme.com") + ",ldaps://" + o.ObfuscateFQDN("ldap3.acme.com")},
+	}
+	for _, tc := range tests {
+		if lines[tc.line] != tc.expected {
+			t.Errorf("line %d = %q, expected %q", tc.line+1, lines[tc.line], tc.expected)
+		}
+	}
+}
+
+func TestObfuscateConfigSameHost(t *testing.T) {
+	o := NewObfuscator()
+	conf := "net:\n" +
+		"  bindIp: db1.acme.com\n" +
+		"sharding:\n" +
+		"  configDB: acmeCfgRS/db1.acme.com:27019,db2.acme.com:27019\n" +
+		"setParameter:\n" +
+		"  uri: mongodb://db1.acme.com:27017/?replicaSet=acmeRS\n"
+	var buf bytes.Buffer
+	if err := o.ObfuscateConfig(strings.NewReader(conf), &buf); err != nil {
+		t.Fatal(err)
+	}
+	host := o.ObfuscateFQDN("db1.acme.com")
+	lines := strings.Split(buf.String(), "\n")
+	for _, i := range []int{1, 3, 5} {
+		if strings.Contains(lines[i], "acme") || !strings.Contains(lines[i], host+":") && !strings.HasSuffix(lines[i], host) {
+			t.Errorf("line %d should map db1.acme.com to %s, got %q", i+1, host, lines[i])
+		}
+	}
+	if value := o.ObfuscateString("db1.acme.com"); value != host {
+		t.Errorf("a field value should map db1.acme.com to %s, got %q", host, value)
+	}
+}
+
+func TestObfuscateConfigINI(t *testing.T) {
+	o := NewObfuscator()
+	conf := "; legacy config\n" +
+		"bind_ip = 127.0.0.1,10.1.2.3\n" +
+		"dbpath=/data/acme\n" +
+		"replSet=acmeRS\n" +
+		"configdb=acmeCfg/cfg1.acme.com:27019\n" +
+		"sslPEMKeyPassword=s3cret\n"
+
+	var buf bytes.Buffer
+	if err := o.ObfuscateConfig(strings.NewReader(conf), &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "; legacy config\n" +
+		"bind_ip = 127.0.0.1," + o.ObfuscateIP("10.1.2.3") + "\n" +
+		"dbpath=" + o.ObfuscatePath("/data/acme") + "\n" +
+		"replSet=" + o.ObfuscateReplSet("acmeRS") + "\n" +
+		"configdb=" + o.ObfuscateSeedList("acmeCfg/cfg1.acme.com:27019") + "\n" +
+		"sslPEMKeyPassword=********\n"
+	if buf.String() != expected {
+		t.Errorf("ObfuscateConfig =\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestObfuscateConfigList(t *testing.T) {
+	o := NewObfuscator()
+	conf := "net:\n  bindIp:\n    - 10.1.2.3\n    - localhost\nsetParameter:\n  hosts: [db1.acme.com, localhost]\n"
+
+	var buf bytes.Buffer
+	if err := o.ObfuscateConfig(strings.NewReader(conf), &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "net:\n  bindIp:\n    - " + o.ObfuscateIP("10.1.2.3") + "\n    - localhost\nsetParameter:\n  hosts: [" +
+		o.ObfuscateString("db1.acme.com") + ", localhost]\n"
+	if buf.String() != expected {
+		t.Errorf("ObfuscateConfig =\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestObfuscateConfigFile(t *testing.T) {
+	o := NewObfuscator()
+	filename := filepath.Join(t.TempDir(), "mongod.conf")
+	if err := os.WriteFile(filename, []byte("replication:\n  replSetName: acmeRS\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.ObfuscateConfigFile(filename, ""); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "replication:\n  replSetName: "+o.ObfuscateReplSet("acmeRS")+"\n" {
+		t.Errorf("unexpected output %s", data)
+	}
+	if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("file mode should be kept, got %v", info.Mode())
+	}
+}
+
+func TestObfuscatePath(t *testing.T) {
+	o := NewObfuscator()
+	acme := o.ObfuscatePath("acme")
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/var/lib/mongodb", "/var/lib/mongodb"},
+		{"/data/acme/db", "/data/" + acme + "/db"},
+		{"/etc/ssl/acme.pem", "/etc/ssl/" + acme + ".pem"},
+		{`C:\data\acme\mongod.cfg`, `C:\data\` + acme + `\mongod.cfg`},
+	}
+	for _, tc := range tests {
+		if result := o.ObfuscatePath(tc.input); result != tc.expected {
+			t.Errorf("ObfuscatePath(%q) = %q, expected %q", tc.input, result, tc.expected)
+		}
+	}
+	if acme == "acme" || o.GetMappings()["path_map"].(map[string]string)["acme"] != acme {
+		t.Errorf("path segments should be mapped, got %s", acme)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_csv.go
+
+package gox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSVOptions defines how a CSV or TSV stream is obfuscated
+type CSVOptions struct {
+	Comma    rune                           // Single-byte field delimiter, detected from the first line if 0
+	NoHeader bool                           // First record is data instead of column names
+	Columns  map[string]func(string) string // Rules by header name, not allowed with NoHeader
+	Indexes  map[int]func(string) string    // Rules by 0-based column index
+}
+
+// csvField is a parsed CSV field and whether it was quoted in the input
+type csvField struct {
+	value  string
+	quoted bool
+}
+
+// ObfuscateCSVFile obfuscates a CSV or TSV file, which may be compressed, into outfile
+func (o *Obfuscator) ObfuscateCSVFile(infile string, outfile string, opts CSVOptions) error {
+	var err error
+	var out *os.File
+	var reader *Reader
+
+	if reader, err = NewFileReader(infile); err != nil {
+		return err
+	}
+	defer reader.Close()
+	if out, err = os.Create(outfile); err != nil {
+		return err
+	}
+	if err = o.ObfuscateCSV(reader, out, opts); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ObfuscateCSV obfuscates a CSV or TSV stream record by record
+// Columns without a rule fall back to ObfuscateString
+func (o *Obfuscator) ObfuscateCSV(reader io.Reader, writer io.Writer, opts CSVOptions) error {
+	br := bufio.NewReaderSize(reader, 64*1024)
+	if opts.Comma >= utf8.RuneSelf || opts.Comma == '"' || opts.Comma == '\r' || opts.Comma == '\n' {
+		return fmt.Errorf("csv: invalid delimiter %q", opts.Comma)
+	}
+	if opts.NoHeader && len(opts.Columns) > 0 {
+		return errors.New("csv: column rules require a header, use Indexes with NoHeader")
+	}
+	bw := bufio.NewWriterSize(writer, 64*1024)
+	comma := byte(opts.Comma)
+	if opts.Comma == 0 {
+		comma = sniffDelimiter(br)
+	}
+
+	var rules []func(string) string
+	var header []csvField
+	for n := 0; ; n++ {
+		record, eol, err := readCSVRecord(br, comma)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		o.Audit.setLine(n+1, 0)
+		if n == 0 {
+			header = record
+			rules = make([]func(string) string, len(record))
+			for i, field := range record {
+				if fn, ok := opts.Indexes[i]; ok {
+					rules[i] = fn
+				} else if fn, ok := opts.Columns[field.value]; ok {
+					rules[i] = fn
+				}
+			}
+			if !opts.NoHeader {
+				writeCSVRecord(bw, record, comma, eol)
+				continue
+			}
+		}
+		for i := range record {
+			if record[i].value == "" {
+				continue
+			}
+			if i < len(header) && !opts.NoHeader {
+				o.Audit.enter(header[i].value)
+			} else {
+				o.Audit.enterIndex(i)
+			}
+			if i < len(rules) && rules[i] != nil {
+				record[i].value = rules[i](record[i].value)
+			} else if fn, ok := opts.Indexes[i]; ok {
+				record[i].value = fn(record[i].value)
+			} else {
+				record[i].value = o.ObfuscateString(record[i].value)
+			}
+			o.Audit.leave()
+		}
+		writeCSVRecord(bw, record, comma, eol)
+	}
+	return bw.Flush()
+}
+
+// ObfuscateTextFile obfuscates a plain text file, which may be compressed, into outfile
+func (o *Obfuscator) ObfuscateTextFile(infile string, outfile string) error {
+	var err error
+	var out *os.File
+	var reader *Reader
+
+	if reader, err = NewFileReader(infile); err != nil {
+		return err
+	}
+	defer reader.Close()
+	if out, err = os.Create(outfile); err != nil {
+		return err
+	}
+	if err = o.ObfuscateText(reader, out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ObfuscateText obfuscates a plain text stream line by line, keeping line endings
+func (o *Obfuscator) ObfuscateText(reader io.Reader, writer io.Writer) error {
+	br := bufio.NewReaderSize(reader, 64*1024)
+	bw := bufio.NewWriterSize(writer, 64*1024)
+	var offset int64
+	for n := 1; ; n++ {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			o.Audit.setLine(n, offset)
+			offset += int64(len(line))
+			text := strings.TrimRight(line, "\r\n")
+			bw.WriteString(o.ObfuscateString(text))
+			bw.WriteString(line[len(text):])
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// sniffDelimiter returns a tab if the first line has more tabs than commas
+func sniffDelimiter(br *bufio.Reader) byte {
+	buf, _ := br.Peek(4096)
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i]
+	}
+	if bytes.Count(buf, []byte{'\t'}) > bytes.Count(buf, []byte{','}) {
+		return '\t'
+	}
+	return ','
+}
+
+// readCSVRecord reads one record, which may span lines inside quotes, and its line ending
+func readCSVRecord(br *bufio.Reader, comma byte) ([]csvField, string, error) {
+	var record []csvField
+	var buf []byte
+	quoted, inQuotes, started := false, false, false
+
+	endField := func() {
+		record = append(record, csvField{value: string(buf), quoted: quoted})
+		buf = buf[:0]
+		quoted, started = false, false
+	}
+
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			if record == nil && !started && len(buf) == 0 {
+				return nil, "", io.EOF
+			}
+			if inQuotes {
+				return nil, "", errors.New("csv: unterminated quoted field")
+			}
+			endField()
+			return record, "", nil
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		if inQuotes {
+			if c != '"' {
+				buf = append(buf, c)
+			} else if next, _ := br.Peek(1); len(next) == 1 && next[0] == '"' {
+				br.ReadByte()
+				buf = append(buf, '"')
+			} else {
+				inQuotes = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"' && !started:
+			inQuotes, quoted, started = true, true, true
+		case c == comma:
+			endField()
+		case c == '\n':
+			endField()
+			return record, "\n", nil
+		case c == '\r':
+			if next, _ := br.Peek(1); len(next) == 1 && next[0] == '\n' {
+				br.ReadByte()
+				endField()
+				return record, "\r\n", nil
+			}
+			buf = append(buf, c)
+		default:
+			buf = append(buf, c)
+			started = true
+		}
+	}
+}
+
+// writeCSVRecord writes a record, quoting fields that were quoted or need quoting
+func writeCSVRecord(bw *bufio.Writer, record []csvField, comma byte, eol string) {
+	for i, field := range record {
+		if i > 0 {
+			bw.WriteByte(comma)
+		}
+		if field.quoted || strings.ContainsAny(field.value, string(comma)+"\"\r\n") {
+			bw.WriteByte('"')
+			bw.WriteString(strings.ReplaceAll(field.value, `"`, `""`))
+			bw.WriteByte('"')
+		} else {
+			bw.WriteString(field.value)
+		}
+	}
+	bw.WriteString(eol)
+}
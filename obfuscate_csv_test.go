@@ -0,0 +1,128 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_csv_test.go
+
+package gox
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestObfuscateCSV(t *testing.T) {
+	o := NewObfuscator()
+	input := "_id,email,\"note\",count\r\n" +
+		"ObjectId(65f1a2b3c4d5e6f708192a3b),user@example.com,\"from 192.168.1.100, \"\"quoted\"\"\",10\r\n" +
+		"ObjectId(65f1a2b3c4d5e6f708192a3c),other@example.com,\"multi\nline\",20\r\n"
+	opts := CSVOptions{
+		Columns: map[string]func(string) string{"email": o.ObfuscateEmail},
+		Indexes: map[int]func(string) string{3: func(s string) string { return s }},
+	}
+
+	var out bytes.Buffer
+	if err := o.ObfuscateCSV(strings.NewReader(input), &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	result := out.String()
+
+	records, err := csv.NewReader(strings.NewReader(result)).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v\n%s", err, result)
+	}
+	if len(records) != 3 || len(records[1]) != 4 {
+		t.Fatalf("unexpected records %v", records)
+	}
+	if !strings.HasPrefix(result, "_id,email,\"note\",count\r\n") {
+		t.Errorf("header should be kept with its quoting, got %q", result)
+	}
+	if records[1][1] != o.ObfuscateEmail("user@example.com") {
+		t.Errorf("email column should use its rule, got %s", records[1][1])
+	}
+	if strings.Contains(records[1][2], "192.168.1.100") || !strings.Contains(records[1][2], `"quoted"`) {
+		t.Errorf("note should fall back to ObfuscateString, got %s", records[1][2])
+	}
+	if records[1][3] != "10" || records[2][3] != "20" {
+		t.Errorf("count column should be kept by index rule, got %s and %s", records[1][3], records[2][3])
+	}
+	if strings.Contains(records[1][0], "65f1a2b3c4d5e6f708192a3b") {
+		t.Errorf("ObjectId should be obfuscated, got %s", records[1][0])
+	}
+	if !strings.Contains(result, "\"multi\nline\"") {
+		t.Errorf("quoted multi-line field should be kept quoted, got %q", result)
+	}
+}
+
+func TestObfuscateTSV(t *testing.T) {
+	o := NewObfuscator()
+	input := "host\tip\nserver1.example.com\t10.1.2.3\n"
+
+	var out bytes.Buffer
+	if err := o.ObfuscateCSV(strings.NewReader(input), &out, CSVOptions{NoHeader: true}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != 3 || strings.Count(lines[1], "\t") != 1 {
+		t.Fatalf("TSV layout not preserved, got %q", out.String())
+	}
+	// NoHeader treats the first line as data, which has nothing to obfuscate
+	if lines[0] != "host\tip" {
+		t.Errorf("first line should be unchanged, got %q", lines[0])
+	}
+	if strings.Contains(lines[1], "10.1.2.3") || strings.Contains(lines[1], "server1.example.com") {
+		t.Errorf("TSV values should be obfuscated, got %q", lines[1])
+	}
+}
+
+func TestObfuscateCSVInvalidOptions(t *testing.T) {
+	o := NewObfuscator()
+	tests := []CSVOptions{
+		{Comma: '；'},
+		{Comma: '¦'},
+		{Comma: '"'},
+		{NoHeader: true, Columns: map[string]func(string) string{"email": o.ObfuscateEmail}},
+	}
+	for _, opts := range tests {
+		var out bytes.Buffer
+		if err := o.ObfuscateCSV(strings.NewReader("email\nuser@example.com\n"), &out, opts); err == nil {
+			t.Errorf("%+v should be rejected", opts)
+		}
+	}
+}
+
+func TestObfuscateCSVFile(t *testing.T) {
+	o := NewObfuscator()
+	infile := "/tmp/obfuscate.csv.gz"
+	outfile := "/tmp/obfuscate.out.csv"
+	if err := OutputGzipped([]byte("name,ssn\njohn,123-45-6789\n"), infile); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(infile)
+	defer os.Remove(outfile)
+
+	if err := o.ObfuscateCSVFile(infile, outfile, CSVOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(outfile)
+	if !strings.HasPrefix(string(b), "name,ssn\njohn,") || strings.Contains(string(b), "123-45-6789") {
+		t.Errorf("unexpected output %q", string(b))
+	}
+}
+
+func TestObfuscateText(t *testing.T) {
+	o := NewObfuscator()
+	input := "connection from 192.168.1.100\r\nuser user@example.com logged in"
+
+	var out bytes.Buffer
+	if err := o.ObfuscateText(strings.NewReader(input), &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\r\n")
+	if len(lines) != 2 {
+		t.Fatalf("line endings not preserved, got %q", out.String())
+	}
+	if strings.Contains(lines[0], "192.168.1.100") || strings.Contains(lines[1], "user@example.com") {
+		t.Errorf("text should be obfuscated, got %q", out.String())
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_ids.go
+
+package gox
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Pre-compiled regex patterns for MongoDB identifiers
+var (
+	ReObjectID = regexp.MustCompile(`ObjectId\(\s*["']?[0-9a-fA-F]{24}["']?\s*\)|"\$oid"\s*:\s*"[0-9a-fA-F]{24}"`)
+	ReHex24    = regexp.MustCompile(`[0-9a-fA-F]{24}`)
+	ReUUID     = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+	ReBinData  = regexp.MustCompile(`BinData\(\s*(\d+)\s*,\s*["']([A-Za-z0-9+/=]*)["']\s*\)`)
+	ReBinaryV1 = regexp.MustCompile(`"\$binary"\s*:\s*"([A-Za-z0-9+/=]*)"\s*,\s*"\$type"\s*:\s*"([0-9a-fA-F]{1,2})"`)
+	ReBinaryV2 = regexp.MustCompile(`"\$binary"\s*:\s*\{\s*"base64"\s*:\s*"([A-Za-z0-9+/=]*)"\s*,\s*"subType"\s*:\s*"([0-9a-fA-F]{1,2})"\s*\}`)
+)
+
+// ObfuscateObjectID obfuscates a 24-hex ObjectId consistently
+// The embedded timestamp is kept and shifted by DateOffset days so time ordering survives
+func (o *Obfuscator) ObfuscateObjectID(oid string) string {
+	b, err := hex.DecodeString(oid)
+	if err != nil || len(b) != 12 {
+		return oid
+	}
+
+	key := strings.ToLower(oid)
+	if cached, exists := o.IDMap[key]; exists {
+		o.audit("objectid", key, cached)
+		return matchHexCase(cached, oid)
+	}
+
+	ts := int64(binary.BigEndian.Uint32(b[:4])) + int64(o.DateOffset)*86400
+	if ts < 0 {
+		ts = 0
+	} else if ts > math.MaxUint32 {
+		ts = math.MaxUint32
+	}
+	binary.BigEndian.PutUint32(b[:4], uint32(ts))
+	copy(b[4:], o.hashBytes("objectid", key, 8))
+
+	newValue := hex.EncodeToString(b)
+	o.IDMap[key] = newValue
+	o.audit("objectid", key, newValue)
+	return matchHexCase(newValue, oid)
+}
+
+// ObfuscateUUID obfuscates a UUID consistently, keeping its version and variant bits
+func (o *Obfuscator) ObfuscateUUID(uuid string) string {
+	// Canonical lowercase UUIDs are the cache keys
+	if cached, exists := o.IDMap[uuid]; exists && len(uuid) == 36 {
+		o.audit("uuid", uuid, cached)
+		return cached
+	}
+	raw, err := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	if err != nil || len(raw) != 16 {
+		return uuid
+	}
+
+	newValue := formatUUID(o.obfuscateUUIDBytes(raw))
+	o.audit("uuid", formatUUID(raw), newValue)
+	if !strings.Contains(uuid, "-") {
+		newValue = strings.ReplaceAll(newValue, "-", "")
+	}
+	return matchHexCase(newValue, uuid)
+}
+
+// ObfuscateBinary obfuscates base64 encoded BSON binary data consistently
+// Subtype 4 (UUID) payloads map the same way as their UUID string form
+func (o *Obfuscator) ObfuscateBinary(b64 string, subType byte) string {
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil || len(raw) == 0 {
+		return b64
+	}
+
+	if subType == 4 && len(raw) == 16 {
+		newValue := base64.StdEncoding.EncodeToString(o.obfuscateUUIDBytes(raw))
+		o.audit("binary", b64, newValue)
+		return newValue
+	}
+
+	if cached, exists := o.IDMap[b64]; exists {
+		o.audit("binary", b64, cached)
+		return cached
+	}
+	newValue := base64.StdEncoding.EncodeToString(o.hashBytes("binary", b64, len(raw)))
+	o.IDMap[b64] = newValue
+	o.audit("binary", b64, newValue)
+	return newValue
+}
+
+// obfuscateUUIDBytes maps 16 UUID bytes, caching by the canonical string form
+func (o *Obfuscator) obfuscateUUIDBytes(raw []byte) []byte {
+	key := formatUUID(raw)
+	if cached, exists := o.IDMap[key]; exists {
+		b, _ := hex.DecodeString(strings.ReplaceAll(cached, "-", ""))
+		return b
+	}
+
+	b := o.hashBytes("uuid", key, 16)
+	// Version is the high nibble of byte 6, the variant is the leading 1-3 bits of byte 8
+	b[6] = b[6]&0x0f | raw[6]&0xf0
+	var mask byte
+	switch {
+	case raw[8]&0x80 == 0:
+		mask = 0x80
+	case raw[8]&0x40 == 0:
+		mask = 0xc0
+	default:
+		mask = 0xe0
+	}
+	b[8] = b[8]&^mask | raw[8]&mask
+
+	o.IDMap[key] = formatUUID(b)
+	return b
+}
+
+// obfuscateExtJSON obfuscates an extended JSON identifier document ($oid, $uuid, $binary)
+func (o *Obfuscator) obfuscateExtJSON(doc map[string]interface{}) (map[string]interface{}, bool) {
+	if oid, ok := doc["$oid"].(string); ok && len(doc) == 1 {
+		return map[string]interface{}{"$oid": o.ObfuscateObjectID(oid)}, true
+	}
+	if uuid, ok := doc["$uuid"].(string); ok && len(doc) == 1 {
+		return map[string]interface{}{"$uuid": o.ObfuscateUUID(uuid)}, true
+	}
+	switch bin := doc["$binary"].(type) {
+	case map[string]interface{}:
+		b64, ok := bin["base64"].(string)
+		subType, _ := bin["subType"].(string)
+		if !ok || len(doc) != 1 {
+			return doc, false
+		}
+		return map[string]interface{}{"$binary": map[string]interface{}{
+			"base64": o.ObfuscateBinary(b64, parseSubType(subType)), "subType": subType}}, true
+	case string:
+		subType, ok := doc["$type"].(string)
+		if !ok || len(doc) != 2 {
+			return doc, false
+		}
+		return map[string]interface{}{"$binary": o.ObfuscateBinary(bin, parseSubType(subType)), "$type": subType}, true
+	}
+	return doc, false
+}
+
+// shieldIDs replaces identifiers with placeholders so later digit rules leave them alone
+func (o *Obfuscator) shieldIDs(value string, shielded *[]string) string {
+	replaceBinary := func(re *regexp.Regexp, b64Group int, typeGroup int, base int) {
+		value = shield(value, re, func(matched string) string {
+			loc := re.FindStringSubmatchIndex(matched)
+			b64 := matched[loc[2*b64Group]:loc[2*b64Group+1]]
+			subType, _ := strconv.ParseUint(matched[loc[2*typeGroup]:loc[2*typeGroup+1]], base, 8)
+			return matched[:loc[2*b64Group]] + o.ObfuscateBinary(b64, byte(subType)) + matched[loc[2*b64Group+1]:]
+		}, shielded)
+	}
+	if strings.Contains(value, "BinData(") {
+		replaceBinary(ReBinData, 2, 1, 10)
+	}
+	if strings.Contains(value, `"$binary"`) {
+		replaceBinary(ReBinaryV1, 1, 2, 16)
+		replaceBinary(ReBinaryV2, 1, 2, 16)
+	}
+	if strings.Contains(value, "ObjectId(") || strings.Contains(value, `"$oid"`) {
+		value = shield(value, ReObjectID, func(matched string) string {
+			loc := ReHex24.FindStringIndex(matched)
+			return matched[:loc[0]] + o.ObfuscateObjectID(matched[loc[0]:loc[1]]) + matched[loc[1]:]
+		}, shielded)
+	}
+	value = shieldAt(value, uuidIndexes(value), o.ObfuscateUUID, shielded)
+	return value
+}
+
+// shieldNUL hides NUL bytes of the input behind a placeholder, so that only placeholders contain NUL
+// It must run first so that input resembling a placeholder is restored as is
+func shieldNUL(value string, shielded *[]string) string {
+	if strings.IndexByte(value, 0) < 0 {
+		return value
+	}
+	*shielded = append(*shielded, "\x00")
+	return strings.ReplaceAll(value, "\x00", placeholder(len(*shielded)-1))
+}
+
+// shield replaces every match of re with fn(match), hidden behind a placeholder
+func shield(value string, re *regexp.Regexp, fn func(string) string, shielded *[]string) string {
+	return shieldAt(value, re.FindAllStringIndex(value, -1), fn, shielded)
+}
+
+// shieldAt replaces value[loc[0]:loc[1]] of every location with fn of it, hidden behind a placeholder
+// Without locations value is returned as is, without a copy
+func shieldAt(value string, locs [][]int, fn func(string) string, shielded *[]string) string {
+	if len(locs) == 0 {
+		return value
+	}
+	var b strings.Builder
+	b.Grow(len(value))
+	last := 0
+	for _, loc := range locs {
+		b.WriteString(value[last:loc[0]])
+		*shielded = append(*shielded, fn(value[loc[0]:loc[1]]))
+		b.WriteString(placeholder(len(*shielded) - 1))
+		last = loc[1]
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+// uuidIndexes returns the locations of ReUUID matches in value, without running the regex
+func uuidIndexes(value string) [][]int {
+	var locs [][]int
+	for from := 0; ; {
+		i := shapeIndex(value[from:], uuidShape)
+		if i < 0 {
+			return locs
+		}
+		start, end := from+i, from+i+len(uuidShape)
+		if (start == 0 || !isWordChar(value[start-1])) && (end == len(value) || !isWordChar(value[end])) {
+			locs = append(locs, []int{start, end})
+			from = end
+		} else {
+			from = start + 1
+		}
+	}
+}
+
+// isWordChar checks if c is a \w character, as used by \b
+func isWordChar(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
+
+// unshield restores placeholders created by shield
+func unshield(value string, shielded []string) string {
+	if len(shielded) == 0 {
+		return value
+	}
+	var b strings.Builder
+	b.Grow(len(value))
+	last := 0
+	for i := strings.IndexByte(value, 0); i >= 0; {
+		// A placeholder is a NUL, letters and a NUL, where only the first NUL can be the end of another
+		j, n := i+1, 0
+		for j < len(value) && value[j] >= 'A' && value[j] <= 'Z' {
+			n = n*26 + int(value[j]-'A')
+			j++
+		}
+		if j == i+1 || j == len(value) || value[j] != 0 {
+			i = nextNUL(value, i+1)
+			continue
+		}
+		if n < len(shielded) {
+			b.WriteString(value[last:i])
+			b.WriteString(shielded[n])
+			last = j + 1
+		}
+		i = nextNUL(value, j+1)
+	}
+	if last == 0 {
+		return value
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+// nextNUL returns the index of the first NUL in value at or after from, or -1
+func nextNUL(value string, from int) int {
+	if i := strings.IndexByte(value[from:], 0); i >= 0 {
+		return from + i
+	}
+	return -1
+}
+
+// placeholder encodes i with letters only so no digit rule can match it
+func placeholder(i int) string {
+	var buf [16]byte
+	j := len(buf) - 1
+	buf[j] = 0
+	for {
+		j--
+		buf[j] = byte('A' + i%26)
+		if i /= 26; i == 0 {
+			break
+		}
+	}
+	j--
+	buf[j] = 0
+	return string(buf[j:])
+}
+
+// hashBytes returns n deterministic bytes derived from s
+func hashBytes(s string, n int) []byte {
+	b := make([]byte, 0, n+sha256.Size)
+	for i := 0; len(b) < n; i++ {
+		hash := sha256.Sum256([]byte(s + ":" + strconv.Itoa(i)))
+		b = append(b, hash[:]...)
+	}
+	return b[:n]
+}
+
+// formatUUID formats 16 bytes as a lowercase 8-4-4-4-12 UUID string
+func formatUUID(b []byte) string {
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// matchHexCase returns value in upper case if original has no lowercase hex letters
+func matchHexCase(value string, original string) string {
+	if strings.IndexFunc(original, unicode.IsLower) < 0 && strings.ContainsAny(original, "ABCDEF") {
+		return strings.ToUpper(value)
+	}
+	return value
+}
+
+// parseSubType parses a hex BSON binary subtype as used by extended JSON
+func parseSubType(s string) byte {
+	n, err := strconv.ParseUint(s, 16, 8)
+	if err != nil {
+		return 0
+	}
+	return byte(n)
+}
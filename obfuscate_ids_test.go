@@ -0,0 +1,171 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_ids_test.go
+
+package gox
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestObfuscateObjectID(t *testing.T) {
+	o := NewObfuscator()
+	oid := "65f1a2b3c4d5e6f708192a3b"
+
+	obfuscated := o.ObfuscateObjectID(oid)
+	if obfuscated == oid || len(obfuscated) != 24 {
+		t.Fatalf("ObjectId should be obfuscated, got %s", obfuscated)
+	}
+	if o.ObfuscateObjectID(oid) != obfuscated {
+		t.Error("ObfuscateObjectID not deterministic")
+	}
+
+	// Timestamp is shifted by DateOffset days
+	before, _ := hex.DecodeString(oid)
+	after, _ := hex.DecodeString(obfuscated)
+	shift := int64(binary.BigEndian.Uint32(after[:4])) - int64(binary.BigEndian.Uint32(before[:4]))
+	if shift != int64(o.DateOffset)*86400 {
+		t.Errorf("ObjectId timestamp shifted by %d seconds, expected %d", shift, o.DateOffset*86400)
+	}
+
+	// Time ordering survives
+	later := o.ObfuscateObjectID("65f1a2b4000000000000000a")
+	if later[:8] <= obfuscated[:8] {
+		t.Errorf("ObjectId ordering not preserved: %s vs %s", obfuscated, later)
+	}
+
+	if upper := o.ObfuscateObjectID(strings.ToUpper(oid)); upper != strings.ToUpper(obfuscated) {
+		t.Errorf("upper case ObjectId should map to the same value, got %s", upper)
+	}
+}
+
+func TestObfuscateUUID(t *testing.T) {
+	o := NewObfuscator()
+	uuid := "3b241101-e2bb-4255-8caf-4136c566a962"
+
+	obfuscated := o.ObfuscateUUID(uuid)
+	if obfuscated == uuid || !ReUUID.MatchString(obfuscated) {
+		t.Fatalf("UUID should be obfuscated, got %s", obfuscated)
+	}
+	if obfuscated[14] != '4' {
+		t.Errorf("UUID version not preserved, got %s", obfuscated)
+	}
+	if !strings.ContainsRune("89ab", rune(obfuscated[19])) {
+		t.Errorf("UUID variant not preserved, got %s", obfuscated)
+	}
+	if o.ObfuscateUUID(strings.ReplaceAll(uuid, "-", "")) != strings.ReplaceAll(obfuscated, "-", "") {
+		t.Error("UUID without dashes should map consistently")
+	}
+}
+
+func TestObfuscateBinary(t *testing.T) {
+	o := NewObfuscator()
+	uuid := "3b241101-e2bb-4255-8caf-4136c566a962"
+	raw, _ := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	b64 := base64.StdEncoding.EncodeToString(raw)
+
+	// Subtype 4 maps the same way as the UUID string
+	obfuscated, _ := base64.StdEncoding.DecodeString(o.ObfuscateBinary(b64, 4))
+	if formatUUID(obfuscated) != o.ObfuscateUUID(uuid) {
+		t.Errorf("binary UUID and UUID string should map to the same value")
+	}
+
+	// Other subtypes keep their length
+	generic := base64.StdEncoding.EncodeToString([]byte("some secret bytes"))
+	result := o.ObfuscateBinary(generic, 0)
+	decoded, err := base64.StdEncoding.DecodeString(result)
+	if err != nil || result == generic || len(decoded) != len("some secret bytes") {
+		t.Errorf("binary should be obfuscated with the same length, got %s", result)
+	}
+}
+
+func TestObfuscateStringIDs(t *testing.T) {
+	o := NewObfuscator()
+	oid := "65f1a2b3c4d5e6f708192a3b"
+	uuid := "3b241101-e2bb-4255-8caf-4136c566a962"
+	newOID := o.ObfuscateObjectID(oid)
+	newUUID := o.ObfuscateUUID(uuid)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{_id: ObjectId("` + oid + `")}`, `{_id: ObjectId("` + newOID + `")}`},
+		{`{"_id": {"$oid": "` + oid + `"}}`, `{"_id": {"$oid": "` + newOID + `"}}`},
+		{`{"lsid": UUID("` + uuid + `")}`, `{"lsid": UUID("` + newUUID + `")}`},
+		{`{"id": {"$uuid": "` + uuid + `"}}`, `{"id": {"$uuid": "` + newUUID + `"}}`},
+	}
+	for _, tc := range tests {
+		if result := o.ObfuscateString(tc.input); result != tc.expected {
+			t.Errorf("ObfuscateString(%q) = %q, expected %q", tc.input, result, tc.expected)
+		}
+	}
+
+	raw, _ := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	b64 := base64.StdEncoding.EncodeToString(raw)
+	newB64 := o.ObfuscateBinary(b64, 4)
+	for _, input := range []string{
+		`{"$binary": {"base64": "` + b64 + `", "subType": "04"}}`,
+		`{"$binary": "` + b64 + `", "$type": "04"}`,
+		`BinData(4, "` + b64 + `")`,
+	} {
+		result := o.ObfuscateString(input)
+		if !strings.Contains(result, newB64) || strings.Contains(result, b64) {
+			t.Errorf("ObfuscateString(%q) = %q, expected %s", input, result, newB64)
+		}
+	}
+}
+
+func TestObfuscateStringPlaceholders(t *testing.T) {
+	o := NewObfuscator()
+	oid := "507f1f77bcf86cd799439011"
+	newOID := o.ObfuscateObjectID(oid)
+	ns := o.ObfuscateNamespace("acme.users")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"acme.users ObjectId('" + oid + "')", ns + " ObjectId('" + newOID + "')"},
+		{"find acme.users {_id: ObjectId('" + oid + "')}", "find " + ns + " {_id: ObjectId('" + newOID + "')}"},
+		// input resembling a placeholder is kept
+		{"raw \x00A\x00 ObjectId('" + oid + "')", "raw \x00A\x00 ObjectId('" + newOID + "')"},
+		{"\x00B\x00\x00", "\x00B\x00\x00"},
+	}
+	for _, tc := range tests {
+		if result := o.ObfuscateString(tc.input); result != tc.expected {
+			t.Errorf("ObfuscateString(%q) = %q, expected %q", tc.input, result, tc.expected)
+		}
+	}
+	for k := range o.NameMap {
+		if strings.IndexByte(k, 0) >= 0 {
+			t.Errorf("a placeholder should not be cached, got %q", k)
+		}
+	}
+}
+
+func TestObfuscateMapExtJSON(t *testing.T) {
+	o := NewObfuscator()
+	oid := "65f1a2b3c4d5e6f708192a3b"
+	doc := map[string]interface{}{
+		"_id":     map[string]interface{}{"$oid": oid},
+		"orderId": map[string]interface{}{"$oid": oid},
+		"binary": map[string]interface{}{
+			"$binary": map[string]interface{}{"base64": "c2VjcmV0", "subType": "00"},
+		},
+	}
+
+	result := o.ObfuscateMap(doc)
+	id := result["_id"].(map[string]interface{})["$oid"]
+	ref := result["orderId"].(map[string]interface{})["$oid"]
+	if id == oid || id != ref {
+		t.Errorf("foreign key references should map to the same ObjectId, got %v and %v", id, ref)
+	}
+	bin := result["binary"].(map[string]interface{})["$binary"].(map[string]interface{})
+	if bin["base64"] == "c2VjcmV0" || bin["subType"] != "00" {
+		t.Errorf("$binary should be obfuscated keeping its subtype, got %v", bin)
+	}
+}
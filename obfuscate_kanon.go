@@ -0,0 +1,216 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_kanon.go
+
+package gox
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Generalization defines how a quasi-identifier is widened, level by level
+type Generalization int
+
+const (
+	// GeneralizeZip masks trailing digits: 94107 → 9410* → 941** → ... → *****
+	GeneralizeZip Generalization = iota
+	// GeneralizeDate buckets dates: 2021-03-15 → 2021-03 → 2021 → 2020s → *
+	GeneralizeDate
+	// GeneralizeNumber buckets numbers, such as ages: 37 → 35-39 → 30-39 → 20-39 → 0-49 → *
+	GeneralizeNumber
+	// GeneralizeCategory suppresses the value: F → *
+	GeneralizeCategory
+)
+
+// numberWidths are bucket widths of GeneralizeNumber levels
+var numberWidths = []float64{5, 10, 20, 50}
+
+// QuasiIdentifier is a field that can re-identify people in combination with others
+type QuasiIdentifier struct {
+	Field string
+	Type  Generalization
+}
+
+// KAnonymityOptions configures KAnonymize
+type KAnonymityOptions struct {
+	K              int     // Minimum size of every combination of quasi-identifiers
+	MaxSuppression float64 // Largest fraction of documents that may be removed (default 0.05)
+}
+
+// KAnonymityReport summarizes the generalization done by KAnonymize
+type KAnonymityReport struct {
+	K          int            `json:"k"`
+	AchievedK  int            `json:"achieved_k"`
+	Groups     int            `json:"groups"`
+	Levels     map[string]int `json:"levels"`
+	Suppressed int            `json:"suppressed"`
+	Total      int            `json:"total"`
+}
+
+// KAnonymize generalizes quasi-identifiers of docs until every combination appears at least K times
+// The field with the most distinct values is widened first; outliers are suppressed within MaxSuppression
+func KAnonymize(docs []map[string]interface{}, qis []QuasiIdentifier, opts KAnonymityOptions) ([]map[string]interface{}, KAnonymityReport) {
+	maxSuppression := opts.MaxSuppression
+	if maxSuppression <= 0 {
+		maxSuppression = 0.05
+	}
+	report := KAnonymityReport{K: opts.K, Levels: map[string]int{}, Total: len(docs)}
+	levels := make([]int, len(qis))
+	for {
+		generalized, groups := generalizeDocs(docs, qis, levels)
+		small := 0
+		for _, n := range groups {
+			if n < opts.K {
+				small += n
+			}
+		}
+
+		next := -1
+		if float64(small) > maxSuppression*float64(len(docs)) {
+			next = widestField(generalized, qis, levels)
+		}
+		if next >= 0 {
+			levels[next]++
+			continue
+		}
+
+		result := make([]map[string]interface{}, 0, len(docs))
+		report.AchievedK = 0
+		for _, doc := range generalized {
+			n := groups[kanonKey(doc, qis)]
+			if n < opts.K {
+				report.Suppressed++
+				continue
+			}
+			if report.AchievedK == 0 || n < report.AchievedK {
+				report.AchievedK = n
+			}
+			result = append(result, doc)
+		}
+		for _, n := range groups {
+			if n >= opts.K {
+				report.Groups++
+			}
+		}
+		for i, qi := range qis {
+			report.Levels[qi.Field] = levels[i]
+		}
+		return result, report
+	}
+}
+
+// generalizeDocs copies docs with quasi-identifiers generalized and counts each combination
+func generalizeDocs(docs []map[string]interface{}, qis []QuasiIdentifier, levels []int) ([]map[string]interface{}, map[string]int) {
+	generalized := make([]map[string]interface{}, len(docs))
+	groups := map[string]int{}
+	for i, doc := range docs {
+		copied := make(map[string]interface{}, len(doc))
+		for k, v := range doc {
+			copied[k] = v
+		}
+		for j, qi := range qis {
+			if v, ok := doc[qi.Field]; ok && levels[j] > 0 {
+				copied[qi.Field] = Generalize(v, qi.Type, levels[j])
+			}
+		}
+		generalized[i] = copied
+		groups[kanonKey(copied, qis)]++
+	}
+	return generalized, groups
+}
+
+// widestField returns the index of the quasi-identifier with the most distinct values that can still be widened
+func widestField(docs []map[string]interface{}, qis []QuasiIdentifier, levels []int) int {
+	next, most := -1, 0
+	for i, qi := range qis {
+		if levels[i] >= maxGeneralization(qi.Type) {
+			continue
+		}
+		distinct := map[string]bool{}
+		for _, doc := range docs {
+			distinct[fmt.Sprint(doc[qi.Field])] = true
+		}
+		if len(distinct) > most {
+			next, most = i, len(distinct)
+		}
+	}
+	return next
+}
+
+// kanonKey returns the combination of quasi-identifier values of doc
+func kanonKey(doc map[string]interface{}, qis []QuasiIdentifier) string {
+	values := make([]string, len(qis))
+	for i, qi := range qis {
+		values[i] = fmt.Sprint(doc[qi.Field])
+	}
+	return strings.Join(values, "\x00")
+}
+
+// maxGeneralization returns the level at which a value is fully suppressed
+func maxGeneralization(t Generalization) int {
+	switch t {
+	case GeneralizeZip:
+		return 5
+	case GeneralizeDate:
+		return 4
+	case GeneralizeNumber:
+		return len(numberWidths) + 1
+	}
+	return 1
+}
+
+// Generalize widens a value by level, level 0 keeps the value
+func Generalize(value interface{}, t Generalization, level int) interface{} {
+	if level <= 0 || value == nil {
+		return value
+	}
+	if level >= maxGeneralization(t) {
+		if t == GeneralizeZip {
+			return strings.Repeat("*", len(fmt.Sprint(value)))
+		}
+		return "*"
+	}
+
+	switch t {
+	case GeneralizeZip:
+		zip := fmt.Sprint(value)
+		if level > len(zip) {
+			level = len(zip)
+		}
+		return zip[:len(zip)-level] + strings.Repeat("*", level)
+	case GeneralizeDate:
+		var date time.Time
+		switch v := value.(type) {
+		case time.Time:
+			date = v
+		default:
+			s := fmt.Sprint(v)
+			if len(s) > 10 {
+				s = s[:10]
+			}
+			var err error
+			if date, err = time.Parse("2006-01-02", s); err != nil {
+				return "*"
+			}
+		}
+		switch level {
+		case 1:
+			return date.Format("2006-01")
+		case 2:
+			return date.Format("2006")
+		}
+		return strconv.Itoa(date.Year()/10*10) + "s"
+	case GeneralizeNumber:
+		f, err := ToFloat64(value)
+		if err != nil {
+			return "*"
+		}
+		width := numberWidths[level-1]
+		lo := math.Floor(f/width) * width
+		return fmt.Sprintf("%v-%v", lo, lo+width-1)
+	}
+	return "*"
+}
@@ -0,0 +1,87 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_kanon_test.go
+
+package gox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGeneralize(t *testing.T) {
+	date := time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    interface{}
+		t        Generalization
+		level    int
+		expected interface{}
+	}{
+		{"94107", GeneralizeZip, 0, "94107"},
+		{"94107", GeneralizeZip, 2, "941**"},
+		{94107, GeneralizeZip, 5, "*****"},
+		{"2021-03-15", GeneralizeDate, 1, "2021-03"},
+		{date, GeneralizeDate, 2, "2021"},
+		{"2021-03-15T10:00:00Z", GeneralizeDate, 3, "2020s"},
+		{date, GeneralizeDate, 4, "*"},
+		{37, GeneralizeNumber, 1, "35-39"},
+		{37, GeneralizeNumber, 3, "20-39"},
+		{37.5, GeneralizeNumber, 4, "0-49"},
+		{37, GeneralizeNumber, 5, "*"},
+		{"F", GeneralizeCategory, 1, "*"},
+	}
+	for _, tc := range tests {
+		if result := Generalize(tc.value, tc.t, tc.level); result != tc.expected {
+			t.Errorf("Generalize(%v, %d, %d) = %v, expected %v", tc.value, tc.t, tc.level, result, tc.expected)
+		}
+	}
+}
+
+func TestKAnonymize(t *testing.T) {
+	docs := []map[string]interface{}{
+		{"zip": "94107", "age": 31, "gender": "F", "ops": 1},
+		{"zip": "94108", "age": 33, "gender": "F", "ops": 2},
+		{"zip": "94109", "age": 36, "gender": "M", "ops": 3},
+		{"zip": "94110", "age": 38, "gender": "M", "ops": 4},
+		{"zip": "94111", "age": 34, "gender": "F", "ops": 5},
+		{"zip": "94112", "age": 39, "gender": "M", "ops": 6},
+	}
+	qis := []QuasiIdentifier{{"zip", GeneralizeZip}, {"age", GeneralizeNumber}, {"gender", GeneralizeCategory}}
+	result, report := KAnonymize(docs, qis, KAnonymityOptions{K: 3})
+
+	if report.AchievedK < 3 || report.Suppressed != 0 || report.Total != 6 || len(result) != 6 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Levels["zip"] == 0 || report.Levels["gender"] != 0 {
+		t.Errorf("zip should be widened and gender kept, got %v", report.Levels)
+	}
+	groups := map[string]int{}
+	for _, doc := range result {
+		groups[kanonKey(doc, qis)]++
+	}
+	for key, n := range groups {
+		if n < 3 {
+			t.Errorf("group %q has %d documents", key, n)
+		}
+	}
+	if docs[0]["zip"] != "94107" || result[0]["ops"] != 1 {
+		t.Errorf("input should be kept and other fields copied")
+	}
+}
+
+func TestKAnonymizeSuppression(t *testing.T) {
+	docs := []map[string]interface{}{}
+	for i := 0; i < 20; i++ {
+		docs = append(docs, map[string]interface{}{"zip": "94107", "gender": "F"})
+	}
+	docs = append(docs, map[string]interface{}{"zip": "10001", "gender": "M"})
+	qis := []QuasiIdentifier{{"zip", GeneralizeZip}, {"gender", GeneralizeCategory}}
+	result, report := KAnonymize(docs, qis, KAnonymityOptions{K: 5, MaxSuppression: 0.1})
+	if report.Suppressed != 1 || len(result) != 20 || report.AchievedK != 20 || report.Levels["zip"] != 0 {
+		t.Errorf("outlier should be suppressed without generalization, got %+v", report)
+	}
+
+	_, report = KAnonymize(docs[:3], qis, KAnonymityOptions{K: 5})
+	if report.Suppressed != 3 || report.AchievedK != 0 {
+		t.Errorf("too few documents should all be suppressed, got %+v", report)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_labels.go
+
+package gox
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PublicSuffixes are domain suffixes kept by NameStyleLabel, in addition to two-letter country codes
+var PublicSuffixes = map[string]bool{
+	"com": true, "net": true, "org": true, "edu": true, "gov": true, "mil": true, "int": true,
+	"io": true, "biz": true, "info": true, "cloud": true, "local": true, "internal": true, "localdomain": true,
+	"co.uk": true, "org.uk": true, "ac.uk": true, "gov.uk": true, "com.au": true, "net.au": true,
+	"co.jp": true, "co.nz": true, "co.in": true, "com.br": true, "com.cn": true, "com.sg": true,
+	"mongodb.net": true,
+}
+
+// ProviderDomains are cloud provider domains kept with KeepProviderDomains
+var ProviderDomains = map[string]bool{
+	"amazonaws.com": true, "compute.amazonaws.com": true, "compute.internal": true, "ec2.internal": true,
+	"azure.com": true, "cloudapp.azure.com": true, "cloudapp.net": true, "windows.net": true,
+	"googleapis.com": true, "googleusercontent.com": true, "c.googlers.com": true, "mongodb.net": true,
+}
+
+// ReCloudRegion matches region labels, such as us-east-1, kept with KeepProviderDomains
+var ReCloudRegion = regexp.MustCompile(`^[a-z]{2}-[a-z]+-\d{1,2}$`)
+
+// ObfuscateLabels obfuscates a hostname label by label so that hosts sharing a domain still share it
+// db1.prod.acme.com and db2.prod.acme.com keep a common obfuscated prod.acme and the .com suffix
+func (o *Obfuscator) ObfuscateLabels(hostname string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(hostname, ".")), ".")
+	keep := o.keptSuffixLen(labels)
+	for i := 0; i < len(labels)-keep; i++ {
+		if o.KeepProviderDomains && ReCloudRegion.MatchString(labels[i]) {
+			continue
+		}
+		labels[i] = o.obfuscateLabel(labels[i])
+	}
+	return strings.Join(labels, ".") + hostname[len(strings.TrimSuffix(hostname, ".")):]
+}
+
+// keptSuffixLen returns the number of trailing labels that are a public suffix or provider domain
+func (o *Obfuscator) keptSuffixLen(labels []string) int {
+	keep := 0
+	for i := len(labels) - 1; i >= 0; i-- {
+		suffix := strings.Join(labels[i:], ".")
+		switch {
+		case PublicSuffixes[suffix], o.KeepProviderDomains && ProviderDomains[suffix]:
+			keep = len(labels) - i
+		case i == len(labels)-1 && len(suffix) == 2 && matchesShape(suffix[0], 'a') && matchesShape(suffix[1], 'a'):
+			keep = 1
+		}
+	}
+	if keep == len(labels) && !PublicSuffixes[strings.Join(labels, ".")] && !ProviderDomains[strings.Join(labels, ".")] {
+		keep--
+	}
+	return keep
+}
+
+// obfuscateLabel maps a single DNS label consistently, labels taken by another input get a counter
+func (o *Obfuscator) obfuscateLabel(label string) string {
+	if label == "" {
+		return label
+	}
+	if cached, exists := o.LabelMap[label]; exists {
+		return cached
+	}
+	newValue := o.uniqueName("label", o.LabelMap, strings.ToLower(o.pickFlower(label)+"-"+o.pickCity(label)))
+	o.LabelMap[label] = newValue
+	return newValue
+}
@@ -0,0 +1,82 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_labels_test.go
+
+package gox
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestObfuscateLabels(t *testing.T) {
+	o := NewObfuscator()
+	o.NameStyle = NameStyleLabel
+	db1 := strings.Split(o.ObfuscateHostname("db1.prod.acme.com"), ".")
+	db2 := strings.Split(o.ObfuscateHostname("DB2.prod.acme.com"), ".")
+	if len(db1) != 4 || db1[3] != "com" || db1[0] == "db1" || db1[1] == "prod" || db1[2] == "acme" {
+		t.Fatalf("unexpected labels %v", db1)
+	}
+	if db1[0] == db2[0] || db1[1] != db2[1] || db1[2] != db2[2] {
+		t.Errorf("shared suffix prod.acme.com should stay shared, got %v and %v", db1, db2)
+	}
+
+	acme := o.obfuscateLabel("acme")
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"acme.co.uk", acme + ".co.uk"},
+		{"www.acme.de", o.obfuscateLabel("www") + "." + acme + ".de"},
+		{"cluster0.abcde.mongodb.net", o.obfuscateLabel("cluster0") + "." + o.obfuscateLabel("abcde") + ".mongodb.net"},
+		{"mongodb.net", "mongodb.net"},
+		{"mongo-prod-01", o.obfuscateLabel("mongo-prod-01")},
+		{"ec2-1-2-3-4.us-east-1.compute.amazonaws.com", o.obfuscateLabel("ec2-1-2-3-4") + "." + o.obfuscateLabel("us-east-1") + "." +
+			o.obfuscateLabel("compute") + "." + o.obfuscateLabel("amazonaws") + ".com"},
+	}
+	for _, tc := range tests {
+		if result := o.ObfuscateLabels(tc.input); result != tc.expected {
+			t.Errorf("ObfuscateLabels(%q) = %q, expected %q", tc.input, result, tc.expected)
+		}
+	}
+
+	if o.ObfuscateString("connect to db1.prod.acme.com") != "connect to "+strings.Join(db1, ".") {
+		t.Errorf("FQDNs in text should map label by label")
+	}
+}
+
+func TestObfuscateLabelsProviderDomains(t *testing.T) {
+	o := NewObfuscator()
+	o.NameStyle = NameStyleLabel
+	o.KeepProviderDomains = true
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ec2-1-2-3-4.us-east-1.compute.amazonaws.com", o.obfuscateLabel("ec2-1-2-3-4") + ".us-east-1.compute.amazonaws.com"},
+		{"acme.blob.core.windows.net", o.obfuscateLabel("acme") + "." + o.obfuscateLabel("blob") + "." + o.obfuscateLabel("core") + ".windows.net"},
+		{"db1.acme.com", o.obfuscateLabel("db1") + "." + o.obfuscateLabel("acme") + ".com"},
+	}
+	for _, tc := range tests {
+		if result := o.ObfuscateLabels(tc.input); result != tc.expected {
+			t.Errorf("ObfuscateLabels(%q) = %q, expected %q", tc.input, result, tc.expected)
+		}
+	}
+	if o.GetMappings()["label_map"].(map[string]string)["acme"] == "" {
+		t.Errorf("labels should be in the mappings")
+	}
+}
+
+func TestObfuscateLabelsCollisions(t *testing.T) {
+	o := NewObfuscator()
+	o.NameStyle = NameStyleLabel
+	seen := map[string]string{}
+	for i := 1; i <= 40; i++ {
+		host := fmt.Sprintf("db%d.prod.acme.com", i)
+		result := o.ObfuscateHostname(host)
+		if other, ok := seen[result]; ok {
+			t.Fatalf("%s and %s both map to %s", other, host, result)
+		}
+		seen[result] = host
+	}
+}
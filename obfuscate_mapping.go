@@ -0,0 +1,89 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_mapping.go
+
+package gox
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+)
+
+// MappingVersion selects the pseudonym derivation algorithm, see MAPPING.md
+type MappingVersion int
+
+const (
+	// MappingV1 is the original FNV-1a/SHA-256 derivation, kept for compatibility
+	MappingV1 MappingVersion = iota
+	// MappingV2 derives every pseudonym from HMAC-SHA256 keyed by SecretKey with a label per rule
+	MappingV2
+)
+
+// mappingV2Prefix is the domain separator of MappingV2 messages
+const mappingV2Prefix = "gox/v2"
+
+// derive returns HMAC-SHA256(SecretKey, "gox/v2" 0x00 label 0x00 input 0x00 counter)
+func (o *Obfuscator) derive(label string, input string, counter int) []byte {
+	mac := hmac.New(sha256.New, []byte(o.SecretKey))
+	mac.Write([]byte(mappingV2Prefix + "\x00" + label + "\x00" + input + "\x00" + strconv.Itoa(counter)))
+	return mac.Sum(nil)
+}
+
+// hashIndex returns a deterministic index (0 to max-1) of input for label and counter
+func (o *Obfuscator) hashIndex(label string, input string, counter int, max int) int {
+	if max <= 0 {
+		return 0
+	}
+	if o.MappingVersion == MappingV1 {
+		switch label {
+		case "flower":
+			return HashIndex(input+"flower", max)
+		case "ssn", "phone":
+			return HashIndex(input+strconv.Itoa(counter), max)
+		case "ip", "mac":
+			return HashOctet(input, counter) % max
+		}
+		return HashIndex(input, max)
+	}
+	return int(binary.BigEndian.Uint64(o.derive(label, input, counter)[:8]) % uint64(max))
+}
+
+// hashHex returns length deterministic lowercase hex characters of input for label
+func (o *Obfuscator) hashHex(label string, input string, length int) string {
+	if o.MappingVersion == MappingV1 {
+		return HashString(input, length)
+	}
+	return hex.EncodeToString(o.hashBytes(label, input, (length+1)/2))[:length]
+}
+
+// hashBytes returns n deterministic bytes of input for label
+func (o *Obfuscator) hashBytes(label string, input string, n int) []byte {
+	b := make([]byte, 0, n+sha256.Size)
+	if o.MappingVersion == MappingV1 {
+		switch label {
+		case "objectid", "uuid", "binary":
+			return hashBytes(input, n)
+		}
+		hash := sha256.Sum256([]byte(input))
+		for len(b) < n {
+			b = append(b, hash[:]...)
+		}
+		return b[:n]
+	}
+	for i := 0; len(b) < n; i++ {
+		b = append(b, o.derive(label, input, i)...)
+	}
+	return b[:n]
+}
+
+// pickCity returns a deterministic city name for input
+func (o *Obfuscator) pickCity(input string) string {
+	return Cities[o.hashIndex("city", input, 0, len(Cities))]
+}
+
+// pickFlower returns a deterministic flower name for input
+func (o *Obfuscator) pickFlower(input string) string {
+	return Flowers[o.hashIndex("flower", input, 0, len(Flowers))]
+}
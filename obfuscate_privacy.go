@@ -0,0 +1,136 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_privacy.go
+
+package gox
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+)
+
+// NoiseMechanism defines the differential privacy noise distribution
+type NoiseMechanism int
+
+const (
+	// NoiseLaplace adds Laplace noise with scale Sensitivity/Epsilon
+	NoiseLaplace NoiseMechanism = iota
+	// NoiseGaussian adds Gaussian noise calibrated to (Epsilon, Delta)
+	NoiseGaussian
+)
+
+// NoiseOptions configures differential privacy noise for aggregate metrics
+type NoiseOptions struct {
+	Release     string         // Table or release identifier, required so that each release gets fresh noise
+	Mechanism   NoiseMechanism // Noise distribution (default NoiseLaplace)
+	Epsilon     float64        // Privacy budget, smaller is noisier (default 1.0)
+	Delta       float64        // Failure probability of NoiseGaussian (default 1e-5)
+	Sensitivity float64        // Largest change one record makes to a value (default 1.0)
+	Min         float64        // Values are clamped to [Min, Max] before noise when Max > Min
+	Max         float64
+	NonNegative bool // Negative results become 0, such as for counts
+	Round       bool // Results are rounded to integers
+}
+
+// AddNoise returns noisy copies of aggregate values, such as op counts per namespace
+// Noise is seeded from SecretKey, the release and the key, so results are reproducible within a release
+func (o *Obfuscator) AddNoise(values map[string]float64, opts NoiseOptions) (map[string]float64, error) {
+	if err := o.checkNoise(opts); err != nil {
+		return nil, err
+	}
+	result := make(map[string]float64, len(values))
+	for k, v := range values {
+		result[k] = o.noisy(k, v, opts)
+	}
+	return result, nil
+}
+
+// AddNoiseColumns returns copies of docs with noise added to numeric values of the named columns
+// Integer values stay integers; other fields are copied as they are
+func (o *Obfuscator) AddNoiseColumns(docs []map[string]interface{}, columns []string, opts NoiseOptions) ([]map[string]interface{}, error) {
+	if err := o.checkNoise(opts); err != nil {
+		return nil, err
+	}
+	result := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		copied := make(map[string]interface{}, len(doc))
+		for k, v := range doc {
+			copied[k] = v
+		}
+		for _, column := range columns {
+			label := column + "\x00" + strconv.Itoa(i)
+			switch v := doc[column].(type) {
+			case int:
+				copied[column] = int(math.Round(o.noisy(label, float64(v), opts)))
+			case int32:
+				copied[column] = int32(math.Round(o.noisy(label, float64(v), opts)))
+			case int64:
+				copied[column] = int64(math.Round(o.noisy(label, float64(v), opts)))
+			case float32:
+				copied[column] = o.noisy(label, float64(v), opts)
+			case float64:
+				copied[column] = o.noisy(label, v, opts)
+			}
+		}
+		result[i] = copied
+	}
+	return result, nil
+}
+
+// checkNoise refuses noise anyone could recompute, without a SecretKey, or repeat across releases, without a Release
+func (o *Obfuscator) checkNoise(opts NoiseOptions) error {
+	if o.SecretKey == "" {
+		return errors.New("noise requires a SecretKey")
+	}
+	if opts.Release == "" {
+		return errors.New("noise requires a Release identifier")
+	}
+	return nil
+}
+
+// noisy clamps value, adds noise seeded by label and applies rounding options
+func (o *Obfuscator) noisy(label string, value float64, opts NoiseOptions) float64 {
+	epsilon, delta, sensitivity := opts.Epsilon, opts.Delta, opts.Sensitivity
+	if epsilon <= 0 {
+		epsilon = 1.0
+	}
+	if delta <= 0 || delta >= 1 {
+		delta = 1e-5
+	}
+	if sensitivity <= 0 {
+		sensitivity = 1.0
+	}
+	if opts.Max > opts.Min {
+		value = math.Max(opts.Min, math.Min(opts.Max, value))
+	}
+
+	hash := o.keyedHash("noise\x00" + opts.Release + "\x00" + label)
+	u1 := uniform(hash[0:8])
+	switch opts.Mechanism {
+	case NoiseGaussian:
+		sigma := sensitivity * math.Sqrt(2*math.Log(1.25/delta)) / epsilon
+		u2 := uniform(hash[8:16])
+		value += sigma * math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+	default:
+		scale := sensitivity / epsilon
+		if u1 < 0.5 {
+			value += scale * math.Log(2*u1)
+		} else {
+			value -= scale * math.Log(2*(1-u1))
+		}
+	}
+
+	if opts.Round {
+		value = math.Round(value)
+	}
+	if opts.NonNegative && value < 0 {
+		value = 0
+	}
+	return value
+}
+
+// uniform maps 8 bytes to a float in (0, 1)
+func uniform(b []byte) float64 {
+	return (float64(binary.BigEndian.Uint64(b)>>11) + 0.5) / (1 << 53)
+}
@@ -0,0 +1,113 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_privacy_test.go
+
+package gox
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestAddNoise(t *testing.T) {
+	o := NewObfuscator()
+	o.SecretKey = "customer-secret"
+	counts := map[string]float64{"acme.users": 1200, "acme.orders": 35, "acme.audit": 0}
+	opts := NoiseOptions{Release: "2024-06", Epsilon: 0.5, NonNegative: true, Round: true}
+
+	result, err := o.AddNoise(counts, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := o.AddNoise(counts, opts)
+	for k, v := range result {
+		if v != again[k] {
+			t.Errorf("noise should be reproducible, %s got %v and %v", k, v, again[k])
+		}
+		if v < 0 || v != math.Round(v) {
+			t.Errorf("%s should be a non-negative integer, got %v", k, v)
+		}
+	}
+	if counts["acme.users"] != 1200 {
+		t.Errorf("input should not be modified")
+	}
+
+	other := NewObfuscator()
+	other.SecretKey = "another-secret"
+	opts = NoiseOptions{Release: "2024-06", Epsilon: 0.5}
+	base, _ := o.AddNoise(counts, opts)
+	byKey, _ := other.AddNoise(counts, opts)
+	byRelease, _ := o.AddNoise(counts, NoiseOptions{Release: "2024-07", Epsilon: 0.5})
+	for k, v := range base {
+		if v == byKey[k] || v == byRelease[k] {
+			t.Errorf("%s: different keys and releases should produce different noise", k)
+		}
+	}
+
+	if _, err = NewObfuscator().AddNoise(counts, opts); err == nil {
+		t.Error("noise without SecretKey should fail")
+	}
+	if _, err = o.AddNoise(counts, NoiseOptions{Epsilon: 0.5}); err == nil {
+		t.Error("noise without Release should fail")
+	}
+
+	clamped, _ := o.AddNoise(map[string]float64{"latency": 1e6}, NoiseOptions{Release: "2024-06", Epsilon: 1e9, Min: 0, Max: 100})
+	if math.Abs(clamped["latency"]-100) > 1e-3 {
+		t.Errorf("value should be clamped to 100, got %v", clamped["latency"])
+	}
+}
+
+func TestAddNoiseDistribution(t *testing.T) {
+	o := NewObfuscator()
+	o.SecretKey = "customer-secret"
+	values := map[string]float64{}
+	for i := 0; i < 20000; i++ {
+		values[strconv.Itoa(i)] = 0
+	}
+	tests := []struct {
+		opts     NoiseOptions
+		expected float64 // standard deviation
+	}{
+		{NoiseOptions{Release: "r1", Epsilon: 0.5}, math.Sqrt2 * 2},
+		{NoiseOptions{Release: "r1", Mechanism: NoiseGaussian, Epsilon: 1, Delta: 1e-5}, math.Sqrt(2 * math.Log(1.25/1e-5))},
+	}
+	for _, tc := range tests {
+		var sum, squares float64
+		noisy, _ := o.AddNoise(values, tc.opts)
+		for _, v := range noisy {
+			sum += v
+			squares += v * v
+		}
+		n := float64(len(values))
+		mean := sum / n
+		stddev := math.Sqrt(squares/n - mean*mean)
+		if math.Abs(mean) > 0.1*tc.expected || math.Abs(stddev-tc.expected) > 0.05*tc.expected {
+			t.Errorf("mechanism %d: mean %v, stddev %v, expected stddev %v", tc.opts.Mechanism, mean, stddev, tc.expected)
+		}
+	}
+}
+
+func TestAddNoiseColumns(t *testing.T) {
+	o := NewObfuscator()
+	o.SecretKey = "customer-secret"
+	docs := []map[string]interface{}{
+		{"ns": "acme.users", "count": 1200, "millis": 35.5},
+		{"ns": "acme.orders", "count": int64(7), "millis": 1.25},
+	}
+	result, err := o.AddNoiseColumns(docs, []string{"count", "millis"}, NoiseOptions{Release: "r1", Epsilon: 1, NonNegative: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result[0]["count"].(int); !ok {
+		t.Errorf("int column should stay int, got %T", result[0]["count"])
+	}
+	if _, ok := result[1]["count"].(int64); !ok {
+		t.Errorf("int64 column should stay int64, got %T", result[1]["count"])
+	}
+	if result[0]["ns"] != "acme.users" || docs[0]["count"] != 1200 {
+		t.Errorf("other fields and input should be kept")
+	}
+	if result[0]["millis"] == 35.5 && result[1]["millis"] == 1.25 {
+		t.Errorf("float columns should get noise")
+	}
+}
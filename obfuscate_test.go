@@ -4,7 +4,11 @@
 package gox
 
 import (
+	"fmt"
+	"hash/fnv"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestHashIndex(t *testing.T) {
@@ -46,6 +50,43 @@ func TestHashOctet(t *testing.T) {
 	}
 }
 
+func TestHashFNV(t *testing.T) {
+	// Inlined FNV-1a must match hash/fnv
+	for _, s := range []string{"", "db1.acme.com", "192.168.1.100", "héllo"} {
+		h := fnv.New32a()
+		h.Write([]byte(s))
+		if HashIndex(s, 1000) != int(h.Sum32())%1000 {
+			t.Errorf("HashIndex(%q) differs from hash/fnv", s)
+		}
+		for _, pos := range []int{0, 2, 17, -3} {
+			h = fnv.New32a()
+			h.Write([]byte(fmt.Sprintf("%s:%d", s, pos)))
+			if HashOctet(s, pos) != int(h.Sum32())%256 {
+				t.Errorf("HashOctet(%q, %d) differs from hash/fnv", s, pos)
+			}
+		}
+	}
+}
+
+func TestHasShape(t *testing.T) {
+	tests := []struct {
+		s        string
+		shape    string
+		expected int
+	}{
+		{"ssn 123-45-6789", ssnShape, 4},
+		{"ssn 123-456-789", ssnShape, -1},
+		{"mac 00:1a:2B-3C:4D:5E", macShape, 4},
+		{"host db1.acme.com", "w.aa", 7},
+		{"version 4.4.1", "w.aa", -1},
+	}
+	for _, tc := range tests {
+		if result := shapeIndex(tc.s, tc.shape); result != tc.expected {
+			t.Errorf("shapeIndex(%q, %q) = %d, expected %d", tc.s, tc.shape, result, tc.expected)
+		}
+	}
+}
+
 func TestHashString(t *testing.T) {
 	// Test determinism
 	hash1 := HashString("test", 8)
@@ -360,6 +401,10 @@ func TestObfuscateDate(t *testing.T) {
 	if len(result) != 10 || result[4] != '-' || result[7] != '-' {
 		t.Errorf("Date format not preserved, got %s", result)
 	}
+	// Every date of a string is shifted in place, including invalid ones
+	if result := o.ObfuscateDate("from 2024-06-15 to 2024-02-30, 12024-06-15"); result != "from 2024-05-04 to 2024-01-18, 12024-05-04" {
+		t.Errorf("ObfuscateDate = %s", result)
+	}
 }
 
 func TestObfuscateMap(t *testing.T) {
@@ -464,3 +509,99 @@ func TestReset(t *testing.T) {
 	}
 }
 
+func TestObfuscateDateDefaultWeekday(t *testing.T) {
+	o := NewObfuscator()
+	o.SecretKey = "customer-a"
+	for _, offset := range []int{o.DateOffset, 0} {
+		if offset == 0 {
+			offset, _ = o.DeriveDateOffset(-365, -30, true)
+		}
+		before, _ := time.Parse("2006-01-02", "2024-03-15")
+		after, err := time.Parse("2006-01-02", o.ObfuscateDate("2024-03-15"))
+		if err != nil || after.Weekday() != before.Weekday() || after.Sub(before) != time.Duration(offset)*24*time.Hour {
+			t.Errorf("offset %d: the default version should keep the weekday, got %v", offset, after)
+		}
+	}
+	if result := NewObfuscator().ObfuscateDate("2024-02-30"); result != "2024-01-18" {
+		t.Errorf("an invalid date should be shifted approximately, got %s", result)
+	}
+}
+
+func TestObfuscateDateWeekday(t *testing.T) {
+	o := NewObfuscator()
+	o.MappingVersion = MappingV2
+	o.DateOffset = -28
+
+	result := o.ObfuscateDate("2024-03-15T10:30:00")
+	if result != "2024-02-16T10:30:00" {
+		t.Errorf("ObfuscateDate should shift by calendar days keeping the time of day, got %s", result)
+	}
+}
+
+func TestDeriveDateOffset(t *testing.T) {
+	o := NewObfuscator()
+	o.SecretKey = "customer-a"
+	offset, err := o.DeriveDateOffset(-365, -30, false)
+	if err != nil || offset < -365 || offset > -30 || o.DateOffset != offset {
+		t.Errorf("DeriveDateOffset out of range: got %d, %v", offset, err)
+	}
+	if again, _ := o.DeriveDateOffset(-365, -30, false); again != offset {
+		t.Error("DeriveDateOffset not deterministic")
+	}
+
+	// Different customers get different offsets
+	o2 := NewObfuscator()
+	o2.SecretKey = "customer-b"
+	if other, _ := o2.DeriveDateOffset(-365, -30, false); other == offset {
+		t.Error("DeriveDateOffset should depend on SecretKey")
+	}
+
+	// Whole weeks keep the weekday
+	weeks, _ := o.DeriveDateOffset(-70, 70, true)
+	if weeks == 0 || weeks%7 != 0 || weeks < -70 || weeks > 70 {
+		t.Errorf("DeriveDateOffset with whole weeks: got %d", weeks)
+	}
+	before, _ := time.Parse("2006-01-02", "2024-06-15")
+	after, _ := time.Parse("2006-01-02", o.ObfuscateDate("2024-06-15"))
+	if before.Weekday() != after.Weekday() {
+		t.Errorf("weekday not preserved: %v vs %v", before.Weekday(), after.Weekday())
+	}
+
+	// Empty or inverted ranges and a missing key fail and keep the current offset
+	for _, r := range [][2]int{{1, 6}, {-30, -365}} {
+		if n, err := o.DeriveDateOffset(r[0], r[1], true); err == nil || n != weeks {
+			t.Errorf("DeriveDateOffset(%d, %d) should fail and keep DateOffset", r[0], r[1])
+		}
+	}
+	if _, err = NewObfuscator().DeriveDateOffset(-365, -30, true); err == nil {
+		t.Error("DeriveDateOffset without SecretKey should fail")
+	}
+}
+
+func TestSaveMappings(t *testing.T) {
+	filename := "/tmp/obfuscate_mappings.json"
+	defer os.Remove(filename)
+
+	o := NewObfuscator()
+	o.SecretKey = "customer-a"
+	o.DeriveDateOffset(-365, -30, true)
+	ip := o.ObfuscateIP("192.168.1.100")
+	email := o.ObfuscateEmail("user@example.com")
+	if err := o.SaveMappings(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	o2 := NewObfuscator()
+	if err := o2.LoadMappings(filename); err != nil {
+		t.Fatal(err)
+	}
+	if o2.DateOffset != o.DateOffset {
+		t.Errorf("date offset not restored: got %d, expected %d", o2.DateOffset, o.DateOffset)
+	}
+	if o2.IPMap["192.168.1.100"] != ip || o2.ObfuscateEmail("user@example.com") != email {
+		t.Error("mappings not restored")
+	}
+	if o2.ObfuscateEmail(email) != email {
+		t.Error("restored replacements should not be obfuscated again")
+	}
+}
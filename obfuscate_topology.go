@@ -0,0 +1,120 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// obfuscate_topology.go
+
+package gox
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Pre-compiled regex patterns for replica set and cluster topology strings
+var (
+	ReSeedList     = regexp.MustCompile(`(^|[^A-Za-z0-9._~/\\\-])([A-Za-z0-9_\-]+/[A-Za-z0-9._\-]+:\d+(?:,[A-Za-z0-9._\-]+:\d+)*)`)
+	ReReplSetField = regexp.MustCompile(`((?:\b|")(?:setName|replSetName|replSet|replicaSet)"?\s*[:=]\s*["']?)([A-Za-z0-9_\-]+)`)
+	ReMongoURI     = regexp.MustCompile(`(mongodb(?:\+srv)?://)([^@/\s]*@)?([A-Za-z0-9._\-:,]+)`)
+)
+
+// ObfuscateSeedList obfuscates setName/host:port,... seed lists, such as shard and config server strings
+// The set name goes through ObfuscateReplSet, members keep their order and ports
+func (o *Obfuscator) ObfuscateSeedList(value string) string {
+	i := strings.Index(value, "/")
+	if i <= 0 {
+		return value
+	}
+	members := strings.Split(value[i+1:], ",")
+	for j, member := range members {
+		members[j] = o.obfuscateSeedMember(member)
+	}
+	return o.ObfuscateReplSet(value[:i]) + "/" + strings.Join(members, ",")
+}
+
+// obfuscateSeedMember obfuscates a host or host:port member, keeping localhost and the port
+func (o *Obfuscator) obfuscateSeedMember(member string) string {
+	host := member
+	if i := strings.LastIndex(member, ":"); i >= 0 {
+		host = member[:i]
+	}
+	if host == "" || host == "localhost" || host == "127.0.0.1" {
+		return member
+	}
+	return o.ObfuscateHostPort(member)
+}
+
+// obfuscateURIHosts obfuscates the user, password and host list of a mongodb:// or mongodb+srv:// connection
+// string prefix, the password is masked
+func (o *Obfuscator) obfuscateURIHosts(matched string) string {
+	groups := ReMongoURI.FindStringSubmatch(matched)
+	userinfo := groups[2]
+	if userinfo != "" {
+		user, password, found := strings.Cut(strings.TrimSuffix(userinfo, "@"), ":")
+		userinfo = o.obfuscateUser(user)
+		if found {
+			o.audit("password", password, "********")
+			userinfo += ":********"
+		}
+		userinfo += "@"
+	}
+	members := strings.Split(groups[3], ",")
+	for i, member := range members {
+		members[i] = o.obfuscateSeedMember(member)
+	}
+	return groups[1] + userinfo + strings.Join(members, ",")
+}
+
+// obfuscateUser obfuscates a user name consistently, an email like other emails
+func (o *Obfuscator) obfuscateUser(user string) string {
+	if user == "" {
+		return user
+	} else if ContainsEmail(user) {
+		return o.ObfuscateEmail(user)
+	}
+	if cached, exists := o.NameMap[user]; exists {
+		o.audit("user", user, cached)
+		return cached
+	}
+	var newValue string
+	if o.NameStyle == NameStyleHash {
+		newValue = "user-" + o.hashHex("user", user, 8)
+	} else {
+		newValue = o.uniqueName("user", o.NameMap, strings.ToLower(o.pickFlower(user)+"-"+o.pickCity(user)))
+	}
+	o.NameMap[user] = newValue
+	o.audit("user", user, newValue)
+	o.NameMap[newValue] = newValue
+	return newValue
+}
+
+// shieldTopology replaces seed lists and replica set name fields with placeholders
+func (o *Obfuscator) shieldTopology(value string, shielded *[]string) string {
+	if strings.IndexByte(value, '/') >= 0 {
+		if strings.Contains(value, "mongodb") {
+			value = shield(value, ReMongoURI, o.obfuscateURIHosts, shielded)
+		}
+		// set names preceded by a path character are source locations, such as src/mongo/db/repl/oplog.cpp:123
+		value = ReSeedList.ReplaceAllStringFunc(value, func(matched string) string {
+			groups := ReSeedList.FindStringSubmatch(matched)
+			*shielded = append(*shielded, o.ObfuscateSeedList(groups[2]))
+			return groups[1] + placeholder(len(*shielded)-1)
+		})
+	}
+	if strings.Contains(value, "setName") || strings.Contains(value, "replSet") || strings.Contains(value, "replicaSet") {
+		value = shield(value, ReReplSetField, func(matched string) string {
+			groups := ReReplSetField.FindStringSubmatch(matched)
+			return groups[1] + o.ObfuscateReplSet(groups[2])
+		}, shielded)
+	}
+	return value
+}
+
+// isReplSetField checks if key holds a replica set name, including _id of a replica set config
+func isReplSetField(key string, doc map[string]interface{}) bool {
+	switch key {
+	case "setName", "replSetName", "replSet", "replicaSet":
+		return true
+	case "_id":
+		_, ok := doc["members"].([]interface{})
+		return ok
+	}
+	return false
+}
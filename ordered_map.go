@@ -5,6 +5,8 @@ package gox
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"sort"
 )
 
@@ -57,3 +59,137 @@ func (om OrderedMap) MarshalJSON() ([]byte, error) {
 	buffer.WriteRune('}')
 	return buffer.Bytes(), nil
 }
+
+// plainMap returns the map with nested ordered maps as plain maps
+func (om *OrderedMap) plainMap() map[string]interface{} {
+	doc := make(map[string]interface{}, len(om.Map))
+	for key, value := range om.Map {
+		if nested, ok := value.(*OrderedMap); ok {
+			value = nested.plainMap()
+		}
+		doc[key] = value
+	}
+	return doc
+}
+
+// orderedLike returns a map as an OrderedMap with the keys order of like, and other keys sorted at the end
+func orderedLike(doc map[string]interface{}, like *OrderedMap) *OrderedMap {
+	om := &OrderedMap{Map: make(map[string]interface{}, len(doc))}
+	var rest []string
+	for key := range doc {
+		if _, ok := like.Map[key]; !ok {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range append(append([]string(nil), like.SortedKeys...), rest...) {
+		value, ok := doc[key]
+		if !ok {
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			nestedLike, _ := like.Map[key].(*OrderedMap)
+			if nestedLike == nil {
+				nestedLike = &OrderedMap{}
+			}
+			value = orderedLike(nested, nestedLike)
+		}
+		om.SortedKeys = append(om.SortedKeys, key)
+		om.Map[key] = value
+	}
+	return om
+}
+
+// decodeOrderedJSON decodes a JSON value with objects as *OrderedMap and numbers as json.Number
+func decodeOrderedJSON(b []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	value, err := decodeOrderedValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid data after top-level value")
+	}
+	return value, nil
+}
+
+// decodeOrderedValue decodes the next value of a decoder
+func decodeOrderedValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		om := &OrderedMap{Map: map[string]interface{}{}}
+		for decoder.More() {
+			if token, err = decoder.Token(); err != nil {
+				return nil, err
+			}
+			key, _ := token.(string)
+			var value interface{}
+			if value, err = decodeOrderedValue(decoder); err != nil {
+				return nil, err
+			}
+			if _, exists := om.Map[key]; !exists {
+				om.SortedKeys = append(om.SortedKeys, key)
+			}
+			om.Map[key] = value
+		}
+		_, err = decoder.Token()
+		return om, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for decoder.More() {
+			var value interface{}
+			if value, err = decodeOrderedValue(decoder); err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err = decoder.Token()
+		return arr, err
+	}
+	return token, nil
+}
+
+// encodeOrderedJSON writes a value decoded by decodeOrderedJSON in compact form, without HTML escaping
+func encodeOrderedJSON(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case *OrderedMap:
+		buf.WriteByte('{')
+		for i, key := range v.SortedKeys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeOrderedJSON(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := encodeOrderedJSON(buf, v.Map[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeOrderedJSON(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		encoder := json.NewEncoder(buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1) // trailing newline
+	}
+	return nil
+}
@@ -3,6 +3,7 @@
 package gox
 
 import (
+	"bytes"
 	"encoding/json"
 	"testing"
 )
@@ -15,3 +16,21 @@ func TestNewOrderedMap(t *testing.T) {
 		t.Fatal("Expected", str, "but got", string(data))
 	}
 }
+
+func TestDecodeOrderedJSON(t *testing.T) {
+	str := `{"b":1,"a":{"y":[1.5,{"z":null,"x":true}],"x":"<>"},"c":12345678901234567890}`
+	doc, err := decodeOrderedJSON([]byte(str))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = encodeOrderedJSON(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != str {
+		t.Fatal("Expected", str, "but got", buf.String())
+	}
+	if _, err = decodeOrderedJSON([]byte(`{"a":1} {}`)); err == nil {
+		t.Fatal("Expected an error for trailing data")
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// parallel.go
+
+package gox
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// DefaultChunkSize is the default number of bytes processed at a time by a worker
+const DefaultChunkSize = 16 * 1024 * 1024
+
+// ParallelOptions defines how a file is split and processed concurrently
+type ParallelOptions struct {
+	Workers   int   // Number of workers, runtime.NumCPU() if 0
+	ChunkSize int64 // Approximate bytes per chunk, DefaultChunkSize if 0
+}
+
+// chunk is a range of whole lines, read from the file by a worker if data is nil
+type chunk struct {
+	index  int
+	offset int64
+	length int64
+	data   []byte
+}
+
+// CountLinesParallel counts '\n' of a file with concurrent workers
+func CountLinesParallel(filename string, opts ParallelOptions) (int, error) {
+	counts, err := ProcessLines(filename, opts, func(data []byte) (int, error) {
+		return bytes.Count(data, []byte{'\n'}), nil
+	})
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total, err
+}
+
+// ProcessLines calls fn concurrently for chunks of whole lines and returns the results in file order
+// A plain file is split into byte ranges aligned to newlines and read by the workers, a compressed file, or a raw
+// snappy block by its .sz or .snappy extension as with NewFileReader, is decompressed by one reader that fans chunks
+// out to the workers
+func ProcessLines[T any](filename string, opts ParallelOptions, fn func(data []byte) (T, error)) ([]T, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	magic := make([]byte, 10)
+	n, _ := io.ReadFull(file, magic)
+	magic = magic[:n]
+	rawSnappy := hasSnappyExt(filename)
+	compressed := IsCompressed(magic) || rawSnappy
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var mutex sync.Mutex
+	var results []T
+	var firstErr error
+	done := make(chan struct{})
+	fail := func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			close(done)
+		}
+	}
+
+	chunks := make(chan chunk, opts.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				if c.data == nil {
+					c.data = make([]byte, c.length)
+					if _, err := file.ReadAt(c.data, c.offset); err != nil && err != io.EOF {
+						fail(err)
+						continue
+					}
+				}
+				result, err := fn(c.data)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				mutex.Lock()
+				for len(results) <= c.index {
+					var zero T
+					results = append(results, zero)
+				}
+				results[c.index] = result
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	if compressed {
+		err = sendDecompressedChunks(file, rawSnappy, opts.ChunkSize, chunks, done)
+	} else {
+		err = sendFileChunks(file, opts.ChunkSize, chunks, done)
+	}
+	close(chunks)
+	wg.Wait()
+	if err != nil {
+		return results, err
+	}
+	return results, firstErr
+}
+
+// sendFileChunks sends byte ranges of a plain file ending at newlines, for workers to read
+func sendFileChunks(file *os.File, chunkSize int64, chunks chan<- chunk, done <-chan struct{}) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	buf := make([]byte, 64*1024)
+	var offset int64
+	for index := 0; offset < size; index++ {
+		end := offset + chunkSize
+		for end < size {
+			n, err := file.ReadAt(buf, end)
+			if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+				end += int64(i) + 1
+				break
+			} else if err != nil && err != io.EOF {
+				return err
+			}
+			end += int64(n)
+		}
+		if end > size {
+			end = size
+		}
+		select {
+		case chunks <- chunk{index: index, offset: offset, length: end - offset}:
+		case <-done:
+			return nil
+		}
+		offset = end
+	}
+	return nil
+}
+
+// sendDecompressedChunks decompresses a file and sends chunks of whole lines to workers
+func sendDecompressedChunks(file *os.File, rawSnappy bool, chunkSize int64, chunks chan<- chunk,
+	done <-chan struct{}) error {
+	reader, err := newReader(file, rawSnappy)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for index := 0; ; index++ {
+		data := make([]byte, chunkSize)
+		n, err := io.ReadFull(reader, data)
+		data = data[:n]
+		if err == nil {
+			// complete the last line
+			var rest []byte
+			rest, err = reader.ReadBytes('\n')
+			data = append(data, rest...)
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if len(data) > 0 {
+			select {
+			case chunks <- chunk{index: index, data: data}:
+			case <-done:
+				return nil
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// parallel_test.go
+
+package gox
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func TestCountLinesParallel(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&buf, "line %d %s\n", i, strings.Repeat("x", i%97))
+	}
+	buf.WriteString("no newline")
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "mongod.log")
+	os.WriteFile(plain, buf.Bytes(), 0644)
+	gzipped := filepath.Join(dir, "mongod.log.gz")
+	OutputGzipped(buf.Bytes(), gzipped)
+	zstd := filepath.Join(dir, "mongod.log.zst")
+	OutputZstd(buf.Bytes(), zstd)
+
+	for _, filename := range []string{plain, gzipped, zstd} {
+		for _, opts := range []ParallelOptions{{}, {Workers: 3, ChunkSize: 1000}, {Workers: 1, ChunkSize: 1}} {
+			if count, err := CountLinesParallel(filename, opts); err != nil || count != 10000 {
+				t.Errorf("%s with %+v: %d %v", filepath.Base(filename), opts, count, err)
+			}
+		}
+	}
+}
+
+func TestProcessLines(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&buf, "%d\n", i)
+	}
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "numbers.txt")
+	os.WriteFile(plain, buf.Bytes(), 0644)
+	gzipped := filepath.Join(dir, "numbers.txt.gz")
+	OutputGzipped(buf.Bytes(), gzipped)
+	raw := filepath.Join(dir, "numbers.txt.sz")
+	os.WriteFile(raw, snappy.Encode(nil, buf.Bytes()), 0644)
+
+	for _, filename := range []string{plain, gzipped, raw} {
+		chunks, err := ProcessLines(filename, ParallelOptions{Workers: 4, ChunkSize: 100}, func(data []byte) (string, error) {
+			if !bytes.HasSuffix(data, []byte{'\n'}) {
+				return "", errors.New("chunk should end at a newline")
+			}
+			return string(data), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunks) < 2 || strings.Join(chunks, "") != buf.String() {
+			t.Errorf("%s: chunks should cover the file in order, got %d chunks", filepath.Base(filename), len(chunks))
+		}
+	}
+
+	expected := errors.New("bad line")
+	_, err := ProcessLines(plain, ParallelOptions{ChunkSize: 100}, func(data []byte) (int, error) {
+		return 0, expected
+	})
+	if err != expected {
+		t.Errorf("expected callback error, got %v", err)
+	}
+}
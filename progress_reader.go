@@ -0,0 +1,161 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// progress_reader.go
+
+package gox
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Progress is a snapshot of a ProgressReader
+type Progress struct {
+	Total      int64         // Size of the source, 0 if unknown
+	Read       int64         // Bytes consumed from the source, compressed
+	Bytes      int64         // Bytes returned, decompressed
+	Lines      int64         // Lines returned
+	Elapsed    time.Duration // Time since the reader was created
+	Throughput float64       // Source bytes per second
+	ETA        time.Duration // Estimated time remaining, 0 if unknown
+	Done       bool          // True once the end is reached
+}
+
+// Percent returns the percentage of the source consumed, 0 if the size is unknown
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+	return 100 * float64(p.Read) / float64(p.Total)
+}
+
+// ProgressOptions defines how often progress is reported
+type ProgressOptions struct {
+	Interval time.Duration  // Time between callbacks, a second if 0
+	Callback func(Progress) // Called from the reading goroutine at most once an interval and at the end
+}
+
+// ProgressReader is a decompressing reader that tracks compressed and decompressed bytes and lines
+// Bytes and lines count what is returned to the caller. Progress can be called from other goroutines, such as a web
+// UI handler
+type ProgressReader struct {
+	source  *Reader
+	opts    ProgressOptions
+	total   int64
+	read    atomic.Int64
+	bytes   atomic.Int64
+	lines   atomic.Int64
+	done    atomic.Bool
+	started time.Time
+	last    time.Time
+}
+
+// NewProgressReader returns a progress tracking reader of a file, decompressed as by NewFileReader
+func NewProgressReader(filename string, opts ProgressOptions) (*ProgressReader, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := newProgressReader(info.Size(), opts)
+	if p.source, err = newFileReader(filename, func(r io.Reader) io.Reader {
+		return &sourceCounter{reader: r, count: &p.read}
+	}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewProgressReaderFrom returns a progress tracking reader of a stream of total bytes, 0 if unknown
+func NewProgressReaderFrom(r io.Reader, total int64, opts ProgressOptions) (*ProgressReader, error) {
+	var err error
+	p := newProgressReader(total, opts)
+	if p.source, err = NewReader(&sourceCounter{reader: r, count: &p.read}); err != nil {
+		return nil, err
+	}
+	if closer, ok := r.(io.Closer); ok {
+		p.source.closers = append(p.source.closers, closer)
+	}
+	return p, nil
+}
+
+// newProgressReader returns a progress reader without a source
+func newProgressReader(total int64, opts ProgressOptions) *ProgressReader {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	p := &ProgressReader{opts: opts, total: total, started: time.Now()}
+	p.last = p.started
+	return p
+}
+
+// Read reads decompressed bytes
+func (p *ProgressReader) Read(b []byte) (int, error) {
+	n, err := p.source.Read(b)
+	p.consumed(b[:n], err)
+	return n, err
+}
+
+// ReadBytes reads until the first occurrence of delim, as bufio.Reader
+func (p *ProgressReader) ReadBytes(delim byte) ([]byte, error) {
+	line, err := p.source.ReadBytes(delim)
+	p.consumed(line, err)
+	return line, err
+}
+
+// ReadString reads until the first occurrence of delim, as bufio.Reader
+func (p *ProgressReader) ReadString(delim byte) (string, error) {
+	line, err := p.ReadBytes(delim)
+	return string(line), err
+}
+
+// consumed counts bytes and lines returned to the caller and reports progress
+func (p *ProgressReader) consumed(b []byte, err error) {
+	p.bytes.Add(int64(len(b)))
+	p.lines.Add(int64(bytes.Count(b, []byte{'\n'})))
+	if err == io.EOF && !p.done.Load() {
+		p.done.Store(true)
+		p.report()
+	} else if now := time.Now(); now.Sub(p.last) >= p.opts.Interval {
+		p.last = now
+		p.report()
+	}
+}
+
+// report calls the callback
+func (p *ProgressReader) report() {
+	if p.opts.Callback != nil {
+		p.opts.Callback(p.Progress())
+	}
+}
+
+// Progress returns the current progress
+func (p *ProgressReader) Progress() Progress {
+	progress := Progress{Total: p.total, Read: p.read.Load(), Bytes: p.bytes.Load(), Lines: p.lines.Load(),
+		Elapsed: time.Since(p.started), Done: p.done.Load()}
+	if seconds := progress.Elapsed.Seconds(); seconds > 0 {
+		progress.Throughput = float64(progress.Read) / seconds
+	}
+	if progress.Throughput > 0 && progress.Total > progress.Read && !progress.Done {
+		progress.ETA = time.Duration(float64(progress.Total-progress.Read) / progress.Throughput * float64(time.Second))
+	}
+	return progress
+}
+
+// Close closes the decompressor and the source
+func (p *ProgressReader) Close() error {
+	return p.source.Close()
+}
+
+// sourceCounter counts bytes read from a source
+type sourceCounter struct {
+	reader io.Reader
+	count  *atomic.Int64
+}
+
+func (c *sourceCounter) Read(b []byte) (int, error) {
+	n, err := c.reader.Read(b)
+	c.count.Add(int64(n))
+	return n, err
+}
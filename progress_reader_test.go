@@ -0,0 +1,102 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// progress_reader_test.go
+
+package gox
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+func TestProgressReader(t *testing.T) {
+	data := strings.Repeat(`{"msg":"Connection accepted","attr":{"remote":"10.20.30.40:51234"}}`+"\n", 20000)
+	dir := t.TempDir()
+	for _, name := range []string{"mongod.log", "mongod.log.gz"} {
+		filename := filepath.Join(dir, name)
+		w, _ := NewFileWriter(filename, FileWriterOptions{})
+		w.Write([]byte(data))
+		w.Close()
+		info, _ := os.Stat(filename)
+
+		var reports []Progress
+		reader, err := NewProgressReader(filename, ProgressOptions{Interval: time.Nanosecond, Callback: func(p Progress) {
+			reports = append(reports, p)
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := 0
+		for {
+			if _, err = reader.ReadString('\n'); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			lines++
+		}
+		if err = reader.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(reports) < 2 {
+			t.Fatalf("%s: expected several reports, got %d", name, len(reports))
+		}
+		for i := 1; i < len(reports); i++ {
+			if reports[i].Read < reports[i-1].Read || reports[i].Lines < reports[i-1].Lines {
+				t.Errorf("%s: progress should not go backwards", name)
+			}
+		}
+		last := reports[len(reports)-1]
+		if !last.Done || last.Read != info.Size() || last.Total != info.Size() || last.Percent() != 100 {
+			t.Errorf("%s: unexpected final progress %+v", name, last)
+		}
+		if last.Bytes != int64(len(data)) || last.Lines != 20000 || lines != 20000 {
+			t.Errorf("%s: expected %d bytes and 20000 lines, got %+v", name, len(data), last)
+		}
+		if reports[0].Done || reports[0].ETA < 0 || last.ETA != 0 {
+			t.Errorf("%s: unexpected ETA %v %v", name, reports[0].ETA, last.ETA)
+		}
+	}
+}
+
+func TestProgressReaderFrom(t *testing.T) {
+	reader, err := NewProgressReaderFrom(strings.NewReader("a\nb\nc"), 0, ProgressOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(reader)
+	if p := reader.Progress(); string(b) != "a\nb\nc" || p.Lines != 2 || p.Percent() != 0 || !p.Done {
+		t.Errorf("unexpected progress %+v", p)
+	}
+}
+
+func TestProgressReaderConsumed(t *testing.T) {
+	data := strings.Repeat("2024-06-15T10:00:00.000+0000 I NETWORK connection accepted\n", 1000)
+	filename := filepath.Join(t.TempDir(), "mongod.log.sz")
+	os.WriteFile(filename, snappy.Encode(nil, []byte(data)), 0644)
+
+	reader, err := NewProgressReader(filename, ProgressOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	line, _ := reader.ReadString('\n')
+	if p := reader.Progress(); line != data[:len(line)] || p.Bytes != int64(len(line)) || p.Lines != 1 {
+		t.Errorf("progress should count what was returned, got %q, %+v", line, p)
+	}
+	buf := make([]byte, 10)
+	n, _ := reader.Read(buf)
+	if p := reader.Progress(); p.Bytes != int64(len(line)+n) || p.Lines != 1 {
+		t.Errorf("progress should count what was returned, got %+v", p)
+	}
+	rest, _ := io.ReadAll(reader)
+	if p := reader.Progress(); len(line)+n+len(rest) != len(data) || p.Bytes != int64(len(data)) || p.Lines != 1000 || !p.Done {
+		t.Errorf("a raw snappy file should be decompressed, got %+v", p)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// rotating_writer.go
+
+package gox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateTimeFormat is the timestamp appended to rotated files, as mongod names them
+const RotateTimeFormat = "2006-01-02T15-04-05"
+
+// RotateOptions defines when a RotatingWriter rolls over and what it keeps
+type RotateOptions struct {
+	MaxSize     int64         // Rotate before a write exceeds the size, no limit if 0
+	MaxAge      time.Duration // Rotate a file older than the age, no limit if 0
+	Daily       bool          // Rotate at local midnight
+	Compression Compression   // Compress rotated files with CompressionGzip or CompressionZstd
+	MaxBackups  int           // Rotated files kept, all if 0
+	Mode        os.FileMode   // Permissions, 0644 if 0
+}
+
+// RotatingWriter is an io.WriteCloser appending to a file that is renamed with a timestamp when it rotates
+// It is safe for concurrent writes. A failed compression of a rotated file is returned by the next Write, after p is
+// written, or by Close
+type RotatingWriter struct {
+	filename string
+	opts     RotateOptions
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+
+	background sync.Mutex // serializes compression and pruning of rotated files
+	wg         sync.WaitGroup
+	errMutex   sync.Mutex
+	err        error // background error not yet returned
+}
+
+// NewRotatingWriter opens a file for appending, rotating it as defined by opts
+func NewRotatingWriter(filename string, opts RotateOptions) (*RotatingWriter, error) {
+	if opts.Mode == 0 {
+		opts.Mode = 0644
+	}
+	w := &RotatingWriter{filename: filename, opts: opts, now: time.Now}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open opens or creates the file
+func (w *RotatingWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, w.opts.Mode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = w.now()
+	if info.Size() > 0 {
+		// an existing file, such as after a restart, keeps its age
+		w.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+// Write writes p to the file, rotating it first if due
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.due(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if err == nil {
+		err = w.backgroundErr()
+	}
+	return n, err
+}
+
+// due returns true if writing n bytes should go to a new file
+func (w *RotatingWriter) due(n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	now := w.now()
+	if w.opts.MaxSize > 0 && w.size+n > w.opts.MaxSize {
+		return true
+	}
+	if w.opts.MaxAge > 0 && now.Sub(w.openedAt) >= w.opts.MaxAge {
+		return true
+	}
+	if w.opts.Daily {
+		y1, m1, d1 := w.openedAt.Date()
+		y2, m2, d2 := now.Date()
+		return y1 != y2 || m1 != m2 || d1 != d2
+	}
+	return false
+}
+
+// Rotate renames the current file with a timestamp and opens a new one
+func (w *RotatingWriter) Rotate() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// rotate renames and reopens the file, compressing and pruning rotated files in the background
+func (w *RotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	stamp := w.now().Format(RotateTimeFormat)
+	rotated := w.filename + "." + stamp
+	backups, _ := w.Backups()
+	for i := len(backups) - 1; i >= 0; i-- {
+		// files rotated within the same second are numbered -1, -2 and so on
+		if last, counter, _ := w.backupKey(backups[i]); last == stamp {
+			rotated = fmt.Sprintf("%s-%d", rotated, counter+1)
+			break
+		}
+	}
+	if err := os.Rename(w.filename, rotated); err != nil {
+		w.open() // keep writing to the same file
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.background.Lock()
+		defer w.background.Unlock()
+		if w.opts.Compression == CompressionGzip || w.opts.Compression == CompressionZstd {
+			// a file already pruned by a later rotation is not an error
+			if err := compressFile(rotated, w.opts.Compression, w.opts.Mode); err != nil && !os.IsNotExist(err) {
+				w.errMutex.Lock()
+				if w.err == nil {
+					w.err = fmt.Errorf("compress %s: %w", rotated, err)
+				}
+				w.errMutex.Unlock()
+			}
+		}
+		w.prune()
+	}()
+	return nil
+}
+
+// backgroundErr returns and clears the first error of compressing rotated files
+func (w *RotatingWriter) backgroundErr() error {
+	w.errMutex.Lock()
+	defer w.errMutex.Unlock()
+	err := w.err
+	w.err = nil
+	return err
+}
+
+// compressFile replaces a file with its gzip or zstd compressed copy
+func compressFile(filename string, compression Compression, mode os.FileMode) error {
+	ext := ".gz"
+	if compression == CompressionZstd {
+		ext = ".zst"
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w, err := NewFileWriter(filename+ext, FileWriterOptions{Compression: compression, Mode: mode})
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, file); err != nil {
+		w.Abort()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// prune removes the oldest rotated files beyond MaxBackups
+func (w *RotatingWriter) prune() error {
+	if w.opts.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := w.Backups()
+	if err != nil || len(backups) <= w.opts.MaxBackups {
+		return err
+	}
+	for _, backup := range backups[:len(backups)-w.opts.MaxBackups] {
+		os.Remove(backup)
+	}
+	return nil
+}
+
+// Backups returns rotated files from oldest to newest
+func (w *RotatingWriter) Backups() ([]string, error) {
+	matches, err := filepath.Glob(w.filename + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, match := range matches {
+		if _, _, ok := w.backupKey(match); ok {
+			backups = append(backups, match)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		si, ci, _ := w.backupKey(backups[i])
+		sj, cj, _ := w.backupKey(backups[j])
+		return si < sj || (si == sj && ci < cj)
+	})
+	return backups, nil
+}
+
+// backupKey returns the timestamp and counter of a rotated file name
+func (w *RotatingWriter) backupKey(filename string) (string, int, bool) {
+	suffix := strings.TrimPrefix(filename, w.filename+".")
+	suffix = strings.TrimSuffix(strings.TrimSuffix(suffix, ".gz"), ".zst")
+	if len(suffix) < len(RotateTimeFormat) {
+		return "", 0, false
+	}
+	stamp, rest := suffix[:len(RotateTimeFormat)], suffix[len(RotateTimeFormat):]
+	if _, err := time.Parse(RotateTimeFormat, stamp); err != nil {
+		return "", 0, false
+	}
+	if rest == "" {
+		return stamp, 0, true
+	}
+	counter, err := strconv.Atoi(strings.TrimPrefix(rest, "-"))
+	if err != nil || rest[0] != '-' || counter <= 0 {
+		return "", 0, false
+	}
+	return stamp, counter, true
+}
+
+// Close closes the file and waits for rotated files to be compressed
+func (w *RotatingWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	err := w.file.Close()
+	w.file = nil
+	w.wg.Wait()
+	if err == nil {
+		err = w.backgroundErr()
+	}
+	return err
+}
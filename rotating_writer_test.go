@@ -0,0 +1,152 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// rotating_writer_test.go
+
+package gox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriterSize(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotatingWriter(filename, RotateOptions{MaxSize: 100, MaxBackups: 2, Compression: CompressionGzip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+	w.now = func() time.Time { return clock }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				fmt.Fprintf(w, "writer %d line %d %s\n", i, j, strings.Repeat("x", 10))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := w.Backups()
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %v", backups)
+	}
+	// 27 bytes lines, 3 lines a file, 13 rotations within the same second, the newest are kept
+	for i, backup := range backups {
+		expected := fmt.Sprintf("%s.2024-06-15T10-00-00-%d.gz", filename, i+11)
+		if backup != expected {
+			t.Errorf("expected %s, got %s", expected, backup)
+		}
+	}
+	for _, backup := range backups {
+		if !strings.HasPrefix(filepath.Base(backup), "app.log.2024-06-15T10-00-00") || !strings.HasSuffix(backup, ".gz") {
+			t.Errorf("unexpected backup name %s", backup)
+		}
+		reader, err := NewFileReader(backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(reader)
+		reader.Close()
+		if len(b) > 100 || !strings.HasPrefix(string(b), "writer ") {
+			t.Errorf("%s: unexpected content %q", backup, b)
+		}
+	}
+	if info, _ := os.Stat(filename); info.Size() > 100 {
+		t.Errorf("current file exceeds MaxSize: %d", info.Size())
+	}
+	if _, err = w.Write([]byte("closed\n")); err == nil {
+		t.Errorf("Write after Close should fail")
+	}
+}
+
+func TestRotatingWriterTime(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	tests := []struct {
+		opts     RotateOptions
+		elapsed  time.Duration
+		expected int
+	}{
+		{RotateOptions{Daily: true}, time.Hour, 0},
+		{RotateOptions{Daily: true}, 14 * time.Hour, 1},
+		{RotateOptions{MaxAge: 2 * time.Hour}, time.Hour, 0},
+		{RotateOptions{MaxAge: 2 * time.Hour}, 3 * time.Hour, 1},
+	}
+	for _, tc := range tests {
+		os.RemoveAll(filepath.Dir(filename))
+		clock := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+		w := &RotatingWriter{filename: filename, opts: tc.opts, now: func() time.Time { return clock }}
+		w.opts.Mode = 0644
+		if err := w.open(); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("first\n"))
+		clock = clock.Add(tc.elapsed)
+		w.Write([]byte("second\n"))
+		w.Close()
+		if backups, _ := w.Backups(); len(backups) != tc.expected {
+			t.Errorf("%+v after %v: expected %d backups, got %v", tc.opts, tc.elapsed, tc.expected, backups)
+		}
+	}
+}
+
+func TestRotatingWriterReopen(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(filename, []byte("yesterday\n"), 0644)
+	yesterday := time.Now().AddDate(0, 0, -1)
+	os.Chtimes(filename, yesterday, yesterday)
+
+	w, err := NewRotatingWriter(filename, RotateOptions{Daily: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("today\n"))
+	w.Close()
+	if backups, _ := w.Backups(); len(backups) != 1 {
+		t.Errorf("a file from yesterday should be rotated, got %v", backups)
+	}
+}
+
+func TestRotatingWriterCompressError(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotatingWriter(filename, RotateOptions{Compression: CompressionGzip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("first\n"))
+
+	// the rotated file cannot be read when it is compressed
+	w.background.Lock()
+	w.Rotate()
+	backups, _ := w.Backups()
+	for _, backup := range backups {
+		os.Remove(backup)
+		os.Mkdir(backup, 0755)
+	}
+	w.background.Unlock()
+	w.wg.Wait()
+
+	if n, err := w.Write([]byte("second\n")); n != 7 || err == nil {
+		t.Errorf("expected the compression error after writing, got %d, %v", n, err)
+	}
+	if _, err = w.Write([]byte("third\n")); err != nil {
+		t.Errorf("the error should be returned once, got %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Error(err)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "second\nthird\n" {
+		t.Errorf("unexpected content %q", data)
+	}
+}